@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Command webhook serves a validating admission webhook rejecting invalid
+// SecretProviderClasses of the provider at apply time.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/webhook"
+)
+
+var (
+	listenAddress = flag.String("listen-address", ":8443", "address to serve the webhook on")
+	tlsCertFile   = flag.String("tls-cert-file", "", "path to the TLS certificate, required by the API server")
+	tlsKeyFile    = flag.String("tls-key-file", "", "path to the TLS private key")
+	providerName  = flag.String("provider-name", webhook.DefaultProviderName, "spec.provider of the SecretProviderClasses to validate, the --provider-name of the provider")
+)
+
+func main() {
+	flag.Parse()
+
+	if *tlsCertFile == "" || *tlsKeyFile == "" {
+		log.Fatal("--tls-cert-file and --tls-key-file are required")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/validate", webhook.Handler{ProviderName: *providerName})
+	srv := &http.Server{
+		Addr:              *listenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, os.Interrupt)
+	go func() {
+		sig := <-sigs
+		slog.Info("Received signal to terminate", "signal", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+
+	slog.Info("Listening for connections", "address", *listenAddress)
+	if err := srv.ListenAndServeTLS(*tlsCertFile, *tlsKeyFile); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/server"
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigVersion is the supported version of the --config file
+const ConfigVersion = "v1"
+
+// EnvPrefix prefixes environment variables overriding flags, e.g.
+// OPENSTACK_PROVIDER_POLICY_FILE overrides --policy-file
+const EnvPrefix = "OPENSTACK_PROVIDER_"
+
+// newFlagSet returns the provider flags bound to config and configFile,
+// initialized with the defaults
+func newFlagSet(config *Config, configFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("secrets-store-csi-driver-provider-openstack", flag.ContinueOnError)
+	fs.StringVar(configFile, "config", "", "path to a YAML file setting flags by name, with version: "+ConfigVersion)
+
+	// might be reasonable to migrate /var/run/secrets-store-csi-provider path,
+	// https://github.com/kubernetes-sigs/secrets-store-csi-driver/issues/823
+	fs.StringVar(&config.VolumePath, "volume-path", "/etc/kubernetes/secrets-store-csi-providers", "path to directory where to serve the provider socket")
+	fs.StringVar(&config.ProviderName, "provider-name", DefaultProviderName, "name of the provider SecretProviderClasses refer to, the socket is named <provider-name>.sock")
+	fs.Var((*fileMode)(&config.SocketMode), "socket-mode", "octal permissions of the socket, e.g. 0660, left as created with the process umask if not set")
+	fs.IntVar(&config.SocketUID, "socket-uid", -1, "user ID owning the socket, -1 leaves it unchanged")
+	fs.IntVar(&config.SocketGID, "socket-gid", -1, "group ID owning the socket, -1 leaves it unchanged")
+	fs.IntVar(&config.MaxRecvMsgSize, "max-recv-msg-size", 0, "maximum size in bytes of gRPC messages received, 0 uses the gRPC default of 4 MiB")
+	fs.IntVar(&config.MaxSendMsgSize, "max-send-msg-size", 0, "maximum size in bytes of gRPC messages sent, 0 uses the gRPC default")
+	fs.DurationVar(&config.KeepaliveTime, "keepalive-time", 0, "how long a connection may be idle before the server pings it, 0 uses the gRPC default")
+	fs.DurationVar(&config.KeepaliveTimeout, "keepalive-timeout", 0, "how long to wait for a ping response before closing the connection, 0 uses the gRPC default")
+
+	fs.TextVar(&config.LogLevel, "log-level", slog.LevelInfo, "minimum level of logged messages, one of debug, info, warn, error")
+	fs.StringVar(&config.LogFormat, "log-format", "text", "format of logged messages, text or json")
+
+	fs.StringVar(&config.NameTemplate, "name-template", server.DefaultNameTemplate, "Go template generating application credential names, see server.NameData for available fields")
+	fs.DurationVar(&config.DefaultExpiresIn, "default-expires-in", server.DefaultExpiresIn, "lifetime of application credentials not setting expiresIn")
+	fs.DurationVar(&config.RenewBefore, "renew-before", server.DefaultRenewBefore, "how long before expiry credentials are renewed when the driver rotates secrets, 0 renews them on every rotation poll")
+	fs.StringVar(&config.PolicyFile, "policy-file", "", "path to policy file restricting what SecretProviderClasses may request, everything is allowed if not set")
+	fs.DurationVar(&config.PolicyReloadInterval, "policy-reload-interval", 10*time.Second, "how often to check the policy file for changes")
+	fs.DurationVar(&config.ClientCacheTTL, "client-cache-ttl", 5*time.Minute, "how long to reuse authenticated OpenStack clients, 0 disables caching")
+	fs.DurationVar(&config.CallTimeout, "call-timeout", 15*time.Second, "how long to wait for a single OpenStack call, 0 waits until the driver gives up")
+	fs.DurationVar(&config.MountTimeout, "mount-timeout", 0, "how long a single Mount may take, 0 waits until the driver gives up")
+	fs.DurationVar(&config.TemplateTimeout, "template-timeout", server.DefaultTemplateTimeout, "how long the templates of a single Mount may execute in total, 0 only bounds them by steps")
+
+	fs.StringVar(&config.DefaultCredentialsFile, "default-credentials-file", "", "path to clouds.yaml with credentials used for Pods without nodePublishSecretRef, requires --policy-file")
+	fs.StringVar(&config.DefaultCloud, "default-cloud", "openstack", "name of the cloud in --default-credentials-file")
+	fs.BoolVar(&config.DefaultCredentialsFromEnv, "default-credentials-from-env", false, "use OS_* environment variables as credentials for Pods without nodePublishSecretRef, requires --policy-file")
+	return fs
+}
+
+// loadConfig resolves every flag from the command line args, otherwise from
+// its environment variable, otherwise from the --config file, otherwise its
+// default. It reads the environment and the file anew on every call.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	var config Config
+	var configFile string
+	fs := newFlagSet(&config, &configFile)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if value, ok := lookupEnv(envName("config")); ok && !explicit["config"] {
+		configFile = value
+	}
+	var settings map[string]string
+	if configFile != "" {
+		var err error
+		settings, err = readConfigFile(configFile, fs)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || f.Name == "config" {
+			return
+		}
+		source := envName(f.Name)
+		value, ok := lookupEnv(source)
+		if !ok {
+			source = fmt.Sprintf("%s in %s", f.Name, configFile)
+			value, ok = settings[f.Name]
+		}
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s, error: %w", value, source, err))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// readConfigFile returns the flag values set in the --config file, every key
+// but version names a flag of fs
+//
+//	version: v1
+//	log-level: debug
+//	policy-file: /etc/openstack-provider/policy.yaml
+//	client-cache-ttl: 10m
+func readConfigFile(filename string, fs *flag.FlagSet) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file, error: %w", err)
+	}
+	var raw map[string]any
+	useNumber := func(d *json.Decoder) *json.Decoder {
+		d.UseNumber()
+		return d
+	}
+	if err := yaml.Unmarshal(data, &raw, useNumber); err != nil {
+		return nil, fmt.Errorf("invalid config file %s, error: %w", filename, err)
+	}
+	if raw["version"] != ConfigVersion {
+		return nil, fmt.Errorf("invalid config file %s, error: unsupported version %v, should be %s", filename, raw["version"], ConfigVersion)
+	}
+	delete(raw, "version")
+
+	settings := make(map[string]string, len(raw))
+	for name, value := range raw {
+		if name == "config" || fs.Lookup(name) == nil {
+			return nil, fmt.Errorf("invalid config file %s, error: unknown setting %q", filename, name)
+		}
+		// YAML reads an unquoted 0660 as the number 432, which would be
+		// applied as 0432, so modes have to be quoted
+		if _, ok := fs.Lookup(name).Value.(*fileMode); ok {
+			if _, ok := value.(string); !ok {
+				return nil, fmt.Errorf("invalid config file %s, error: %s should be a quoted string, e.g. \"0660\"", filename, name)
+			}
+		}
+		switch value := value.(type) {
+		case string, json.Number, bool:
+			settings[name] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("invalid config file %s, error: %s should be a string, number or boolean", filename, name)
+		}
+	}
+	return settings, nil
+}
+
+// envName returns the environment variable overriding the flag
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// fileMode is a flag.Value of octal file permissions
+type fileMode os.FileMode
+
+func (m *fileMode) String() string {
+	if m == nil || *m == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+func (m *fileMode) Set(s string) error {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return fmt.Errorf("should be octal, error: %w", err)
+	}
+	*m = fileMode(mode)
+	return nil
+}
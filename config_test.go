@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/server"
+)
+
+func TestLoadConfig(t *testing.T) {
+	defaults := Config{
+		VolumePath:           "/etc/kubernetes/secrets-store-csi-providers",
+		ProviderName:         DefaultProviderName,
+		SocketUID:            -1,
+		SocketGID:            -1,
+		LogLevel:             slog.LevelInfo,
+		LogFormat:            "text",
+		NameTemplate:         server.DefaultNameTemplate,
+		DefaultExpiresIn:     server.DefaultExpiresIn,
+		RenewBefore:          server.DefaultRenewBefore,
+		PolicyReloadInterval: 10 * time.Second,
+		ClientCacheTTL:       5 * time.Minute,
+		CallTimeout:          15 * time.Second,
+		TemplateTimeout:      server.DefaultTemplateTimeout,
+		DefaultCloud:         "openstack",
+	}
+
+	tests := map[string]struct {
+		args       []string
+		env        map[string]string
+		configFile string
+		want       func(*Config)
+		wantErr    string
+	}{
+		"defaults": {
+			want: func(c *Config) {},
+		},
+		"flags": {
+			args: []string{"--policy-file", "policy.yaml", "--socket-mode", "0660", "--log-level", "debug"},
+			want: func(c *Config) {
+				c.PolicyFile = "policy.yaml"
+				c.SocketMode = 0o660
+				c.LogLevel = slog.LevelDebug
+			},
+		},
+		"config file": {
+			args: []string{"--config", "config.yaml"},
+			configFile: `
+version: v1
+policy-file: policy.yaml
+socket-mode: "0660"
+max-recv-msg-size: 8388608
+client-cache-ttl: 10m
+default-credentials-from-env: true
+log-format: json
+`,
+			want: func(c *Config) {
+				c.PolicyFile = "policy.yaml"
+				c.SocketMode = 0o660
+				c.MaxRecvMsgSize = 8 << 20
+				c.ClientCacheTTL = 10 * time.Minute
+				c.DefaultCredentialsFromEnv = true
+				c.LogFormat = "json"
+			},
+		},
+		"config file from environment": {
+			env: map[string]string{"OPENSTACK_PROVIDER_CONFIG": "config.yaml"},
+			configFile: `
+version: v1
+log-level: warn
+`,
+			want: func(c *Config) { c.LogLevel = slog.LevelWarn },
+		},
+		"environment overrides config file": {
+			args: []string{"--config", "config.yaml"},
+			env:  map[string]string{"OPENSTACK_PROVIDER_CLIENT_CACHE_TTL": "1m"},
+			configFile: `
+version: v1
+client-cache-ttl: 10m
+default-cloud: east
+`,
+			want: func(c *Config) {
+				c.ClientCacheTTL = time.Minute
+				c.DefaultCloud = "east"
+			},
+		},
+		"flags override environment": {
+			args: []string{"--client-cache-ttl", "2m"},
+			env:  map[string]string{"OPENSTACK_PROVIDER_CLIENT_CACHE_TTL": "1m"},
+			want: func(c *Config) { c.ClientCacheTTL = 2 * time.Minute },
+		},
+		"invalid environment value": {
+			env:     map[string]string{"OPENSTACK_PROVIDER_SOCKET_UID": "root"},
+			wantErr: `invalid value "root" for OPENSTACK_PROVIDER_SOCKET_UID`,
+		},
+		"invalid config file value": {
+			args: []string{"--config", "config.yaml"},
+			configFile: `
+version: v1
+log-level: verbose
+`,
+			wantErr: `invalid value "verbose" for log-level in`,
+		},
+		"missing version": {
+			args:       []string{"--config", "config.yaml"},
+			configFile: "log-level: debug\n",
+			wantErr:    "unsupported version <nil>, should be v1",
+		},
+		"unknown setting": {
+			args: []string{"--config", "config.yaml"},
+			configFile: `
+version: v1
+metrics-address: :8080
+`,
+			wantErr: `unknown setting "metrics-address"`,
+		},
+		"nested setting": {
+			args: []string{"--config", "config.yaml"},
+			configFile: `
+version: v1
+policy-file:
+  path: policy.yaml
+`,
+			wantErr: "policy-file should be a string, number or boolean",
+		},
+		"unquoted socket mode": {
+			args: []string{"--config", "config.yaml"},
+			configFile: `
+version: v1
+socket-mode: 0660
+`,
+			wantErr: `socket-mode should be a quoted string, e.g. "0660"`,
+		},
+		"missing config file": {
+			args:    []string{"--config", "missing.yaml"},
+			wantErr: "failed to read config file",
+		},
+		"unknown flag": {
+			args:    []string{"--nope"},
+			wantErr: "flag provided but not defined: -nope",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tc.configFile != "" {
+				if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(tc.configFile), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// config files are relative to dir
+			args := make([]string, len(tc.args))
+			for i, arg := range tc.args {
+				if strings.HasSuffix(arg, ".yaml") && i > 0 && tc.args[i-1] == "--config" {
+					arg = filepath.Join(dir, arg)
+				}
+				args[i] = arg
+			}
+			lookupEnv := func(key string) (string, bool) {
+				value, ok := tc.env[key]
+				if key == "OPENSTACK_PROVIDER_CONFIG" && ok {
+					value = filepath.Join(dir, value)
+				}
+				return value, ok
+			}
+
+			config, err := loadConfig(args, lookupEnv)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig failed: %v", err)
+			}
+			want := defaults
+			tc.want(&want)
+			if diff := cmp.Diff(want, config); diff != "" {
+				t.Errorf("config mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package openstacktest
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+type domainRequest struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userRequest struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Password string         `json:"password"`
+	Domain   *domainRequest `json:"domain"`
+}
+
+type tokenCreateRequest struct {
+	Auth struct {
+		Identity struct {
+			Methods  []string `json:"methods"`
+			Password *struct {
+				User userRequest `json:"user"`
+			} `json:"password"`
+			Token *struct {
+				ID string `json:"id"`
+			} `json:"token"`
+			ApplicationCredential *struct {
+				ID     string       `json:"id"`
+				Name   string       `json:"name"`
+				Secret string       `json:"secret"`
+				User   *userRequest `json:"user"`
+			} `json:"application_credential"`
+		} `json:"identity"`
+		Scope map[string]any `json:"scope"`
+	} `json:"auth"`
+}
+
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request) {
+	s.tokenRequests.Add(1)
+
+	var req tokenCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return
+	}
+	identity := req.Auth.Identity
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastTokenRequest = TokenRequest{Methods: identity.Methods, Scope: req.Auth.Scope}
+
+	var t token
+	var ok bool
+	switch {
+	case slices.Contains(identity.Methods, "password") && identity.Password != nil:
+		t.user, ok = s.findUser(identity.Password.User)
+		ok = ok && t.user.Password == identity.Password.User.Password
+	case slices.Contains(identity.Methods, "token") && identity.Token != nil:
+		t, ok = s.tokens[identity.Token.ID]
+		if ok && t.applicationCredential {
+			writeError(w, http.StatusForbidden, "Using a token created with an application credential to create a new token is not allowed.")
+			return
+		}
+		t.project = nil
+	case slices.Contains(identity.Methods, "application_credential") && identity.ApplicationCredential != nil:
+		if req.Auth.Scope != nil {
+			writeError(w, http.StatusBadRequest, "Application credentials cannot request a scope.")
+			return
+		}
+		var ac *ApplicationCredential
+		ac, ok = s.findApplicationCredential(identity.ApplicationCredential.ID, identity.ApplicationCredential.Name, identity.ApplicationCredential.User)
+		if ok && ac.Secret == identity.ApplicationCredential.Secret {
+			t.user = s.userByID(ac.UserID)
+			t.project = s.projectByID(ac.ProjectID)
+			t.applicationCredential = true
+		} else {
+			ok = false
+		}
+	}
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+		return
+	}
+
+	if req.Auth.Scope != nil {
+		t.project = s.findScope(req.Auth.Scope)
+		if t.project == nil {
+			writeError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+			return
+		}
+	}
+
+	id := randomID()
+	s.tokens[id] = t
+
+	now := time.Now().UTC()
+	body := map[string]any{
+		"methods":    identity.Methods,
+		"user":       t.user,
+		"issued_at":  now.Format(time.RFC3339Nano),
+		"expires_at": now.Add(s.TokenTTL).Format(time.RFC3339Nano),
+	}
+	if t.project != nil {
+		body["project"] = t.project
+		body["roles"] = s.assignedRoles(t.user)
+		body["catalog"] = s.catalog(t.project)
+	}
+	w.Header().Set("X-Subject-Token", id)
+	writeJSON(w, http.StatusCreated, map[string]any{"token": body})
+}
+
+// assignedRoles returns the roles of the user on every project
+func (s *Server) assignedRoles(user User) []Role {
+	if len(user.Roles) > 0 {
+		return user.Roles
+	}
+	return s.Roles
+}
+
+func (s *Server) findUser(u userRequest) (User, bool) {
+	for _, user := range s.Users {
+		switch {
+		case u.ID != "" && u.ID == user.ID:
+			return user, true
+		case u.Name != "" && u.Name == user.Name && u.Domain != nil &&
+			(u.Domain.ID == user.Domain.ID || u.Domain.Name == user.Domain.Name):
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *Server) userByID(id string) User {
+	user, _ := s.findUser(userRequest{ID: id})
+	return user
+}
+
+func (s *Server) projectByID(id string) *Project {
+	for _, project := range s.Projects {
+		if project.ID == id {
+			return &project
+		}
+	}
+	return nil
+}
+
+// findScope returns the project of the scope, trusts act in DefaultProject
+func (s *Server) findScope(scope map[string]any) *Project {
+	if _, ok := scope["OS-TRUST:trust"]; ok {
+		return s.projectByID(DefaultProject.ID)
+	}
+	p, ok := scope["project"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	if id, ok := p["id"].(string); ok {
+		return s.projectByID(id)
+	}
+	name, _ := p["name"].(string)
+	domain, _ := p["domain"].(map[string]any)
+	for _, project := range s.Projects {
+		if project.Name == name && (domain["id"] == project.Domain.ID || domain["name"] == project.Domain.Name) {
+			return &project
+		}
+	}
+	return nil
+}
+
+func (s *Server) catalog(project *Project) []any {
+	endpoint := func(service, url string) map[string]any {
+		var endpoints []any
+		for _, iface := range []string{"public", "internal", "admin"} {
+			endpoints = append(endpoints, map[string]any{
+				"id":        service + "-" + iface,
+				"interface": iface,
+				"region":    Region,
+				"region_id": Region,
+				"url":       url,
+			})
+		}
+		return map[string]any{"id": service, "name": service, "type": service, "endpoints": endpoints}
+	}
+	return []any{
+		endpoint("identity", s.URL+"/v3/"),
+		endpoint("key-manager", s.URL+"/key-manager/"),
+		endpoint("object-store", s.URL+"/object-store/v1/AUTH_"+project.ID),
+	}
+}
+
+func (s *Server) findApplicationCredential(id, name string, user *userRequest) (*ApplicationCredential, bool) {
+	if id != "" {
+		ac, ok := s.applicationCredentials[id]
+		return ac, ok
+	}
+	if user == nil {
+		return nil, false
+	}
+	u, ok := s.findUser(*user)
+	if !ok {
+		return nil, false
+	}
+	for _, ac := range s.applicationCredentials {
+		if ac.UserID == u.ID && ac.Name == name {
+			return ac, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) createApplicationCredential(w http.ResponseWriter, r *http.Request, t token) {
+	if r.PathValue("userID") != t.user.ID {
+		writeError(w, http.StatusForbidden, "You are not authorized to perform the requested action.")
+		return
+	}
+	if t.project == nil {
+		writeError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+		return
+	}
+	var req struct {
+		ApplicationCredential struct {
+			Name        string           `json:"name"`
+			Description string           `json:"description"`
+			ExpiresAt   string           `json:"expires_at"`
+			Roles       []map[string]any `json:"roles"`
+			AccessRules []AccessRule     `json:"access_rules"`
+		} `json:"application_credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return
+	}
+
+	ac := &ApplicationCredential{
+		ID:          randomID(),
+		Name:        req.ApplicationCredential.Name,
+		Secret:      randomID(),
+		Description: req.ApplicationCredential.Description,
+		ExpiresAt:   req.ApplicationCredential.ExpiresAt,
+		ProjectID:   t.project.ID,
+		UserID:      t.user.ID,
+		Roles:       s.assignedRoles(t.user),
+	}
+	for _, rule := range req.ApplicationCredential.AccessRules {
+		if rule.Service == "" || rule.Method == "" || rule.Path == "" {
+			writeError(w, http.StatusBadRequest, "Invalid input for field 'access_rules': %+v", rule)
+			return
+		}
+		rule.ID = randomID()
+		ac.AccessRules = append(ac.AccessRules, rule)
+	}
+	if len(req.ApplicationCredential.Roles) > 0 {
+		ac.Roles = nil
+		for _, requested := range req.ApplicationCredential.Roles {
+			i := slices.IndexFunc(s.Roles, func(role Role) bool {
+				return requested["id"] == role.ID || requested["name"] == role.Name
+			})
+			if i < 0 {
+				writeError(w, http.StatusNotFound, "Could not find role: %v.", requested)
+				return
+			}
+			if !slices.Contains(s.assignedRoles(t.user), s.Roles[i]) {
+				writeError(w, http.StatusNotFound, "Could not find role assignment with role: %s, user or group: %s, project, domain, or system: %s.", s.Roles[i].ID, t.user.ID, t.project.ID)
+				return
+			}
+			ac.Roles = append(ac.Roles, s.Roles[i])
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.takenNames[ac.Name] {
+		s.conflicts.Add(1)
+		writeError(w, http.StatusConflict, "Conflict occurred attempting to store application_credential - Duplicate entry.")
+		return
+	}
+	s.takenNames[ac.Name] = true
+	s.applicationCredentials[ac.ID] = ac
+
+	writeJSON(w, http.StatusCreated, map[string]any{"application_credential": applicationCredentialBody(ac, true)})
+}
+
+// applicationCredentialBody returns the credential as Keystone does, with
+// the secret only on creation
+func applicationCredentialBody(ac *ApplicationCredential, withSecret bool) map[string]any {
+	b, _ := json.Marshal(ac)
+	var body map[string]any
+	_ = json.Unmarshal(b, &body)
+	if withSecret {
+		body["secret"] = ac.Secret
+	}
+	return body
+}
+
+func (s *Server) listApplicationCredentials(w http.ResponseWriter, r *http.Request, t token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acs := []any{}
+	for _, ac := range s.applicationCredentials {
+		if ac.UserID == r.PathValue("userID") {
+			acs = append(acs, applicationCredentialBody(ac, false))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"application_credentials": acs})
+}
+
+func (s *Server) getApplicationCredential(w http.ResponseWriter, r *http.Request, t token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ac, ok := s.applicationCredentials[r.PathValue("id")]
+	if !ok || ac.UserID != r.PathValue("userID") {
+		writeError(w, http.StatusNotFound, "Could not find application credential: %s.", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"application_credential": applicationCredentialBody(ac, false)})
+}
+
+func (s *Server) deleteApplicationCredential(w http.ResponseWriter, r *http.Request, t token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ac, ok := s.applicationCredentials[r.PathValue("id")]
+	if !ok || ac.UserID != r.PathValue("userID") {
+		writeError(w, http.StatusNotFound, "Could not find application credential: %s.", r.PathValue("id"))
+		return
+	}
+	delete(s.applicationCredentials, ac.ID)
+	delete(s.takenNames, ac.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,293 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package openstacktest provides an in-process fake OpenStack for tests,
+// serving the parts of Keystone, Barbican and Swift the provider relies on
+// over HTTP, so real gophercloud request flows can be exercised.
+package openstacktest
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Region is the only region of the catalog
+const Region = "RegionOne"
+
+// Domain, Project, Role and User describe Keystone resources of the fake
+type Domain struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Project struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Domain Domain `json:"domain"`
+}
+
+type Role struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type User struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Password string `json:"-"`
+	Domain   Domain `json:"domain"`
+	// Roles are assigned to the user on every project, all Server.Roles if
+	// empty
+	Roles []Role `json:"-"`
+}
+
+// ApplicationCredential is an application credential created in the fake
+type ApplicationCredential struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Secret      string       `json:"-"`
+	Description string       `json:"description"`
+	ExpiresAt   string       `json:"expires_at"`
+	ProjectID   string       `json:"project_id"`
+	Roles       []Role       `json:"roles"`
+	AccessRules []AccessRule `json:"access_rules,omitempty"`
+	UserID      string       `json:"-"`
+}
+
+// AccessRule restricts the API calls of an application credential
+type AccessRule struct {
+	ID      string `json:"id"`
+	Service string `json:"service"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+}
+
+// TokenRequest records identity methods and scope of a token request
+type TokenRequest struct {
+	Methods []string
+	Scope   map[string]any
+}
+
+// token is an issued token, with the user and project it acts for
+type token struct {
+	user    User
+	project *Project
+	// applicationCredential tokens can not be re-scoped
+	applicationCredential bool
+}
+
+// Server is the fake OpenStack. Its fields may be changed before the first
+// request.
+type Server struct {
+	*httptest.Server
+
+	// Users are the users authenticating with a password, Projects and Roles
+	// the projects all of them have all Roles on
+	Users    []User
+	Projects []Project
+	Roles    []Role
+	// TokenTTL is the lifetime of issued tokens
+	TokenTTL time.Duration
+
+	mu                     sync.Mutex
+	tokens                 map[string]token
+	applicationCredentials map[string]*ApplicationCredential
+	takenNames             map[string]bool
+	secrets                map[string][]byte
+	objects                map[string][]byte
+	lastTokenRequest       TokenRequest
+
+	tokenRequests atomic.Int32
+	conflicts     atomic.Int32
+	delay         atomic.Int64
+}
+
+// Default resources of NewServer
+var (
+	DefaultDomain  = Domain{ID: "default", Name: "Default"}
+	DefaultUser    = User{ID: "user-id", Name: "user", Password: "password", Domain: DefaultDomain}
+	DefaultProject = Project{ID: "project-id", Name: "demo", Domain: DefaultDomain}
+	OtherProject   = Project{ID: "other-id", Name: "other", Domain: DefaultDomain}
+	MemberRole     = Role{ID: "member-id", Name: "member"}
+	ReaderRole     = Role{ID: "reader-id", Name: "reader"}
+)
+
+// NewServer starts the fake with DefaultUser having MemberRole and ReaderRole
+// on DefaultProject and OtherProject, and closes it at the end of the test
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		Users:                  []User{DefaultUser},
+		Projects:               []Project{DefaultProject, OtherProject},
+		Roles:                  []Role{MemberRole, ReaderRole},
+		TokenTTL:               time.Hour,
+		tokens:                 map[string]token{},
+		applicationCredentials: map[string]*ApplicationCredential{},
+		takenNames:             map[string]bool{},
+		secrets:                map[string][]byte{},
+		objects:                map[string][]byte{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v3/auth/tokens", s.createToken)
+	mux.HandleFunc("POST /v3/users/{userID}/application_credentials", s.authorized(s.createApplicationCredential))
+	mux.HandleFunc("GET /v3/users/{userID}/application_credentials", s.authorized(s.listApplicationCredentials))
+	mux.HandleFunc("GET /v3/users/{userID}/application_credentials/{id}", s.authorized(s.getApplicationCredential))
+	mux.HandleFunc("DELETE /v3/users/{userID}/application_credentials/{id}", s.authorized(s.deleteApplicationCredential))
+	mux.HandleFunc("GET /key-manager/v1/secrets/{id}", s.authorized(s.getSecret))
+	mux.HandleFunc("GET /key-manager/v1/secrets/{id}/payload", s.authorized(s.getSecretPayload))
+	mux.HandleFunc("GET /object-store/v1/{account}/{container}/{object...}", s.authorized(s.getObject))
+
+	s.Server = httptest.NewServer(s.delayed(mux))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Delay makes every subsequent request wait for d before it is handled, or
+// until the client gives up, e.g. to simulate a hung Keystone
+func (s *Server) Delay(d time.Duration) {
+	s.delay.Store(int64(d))
+}
+
+func (s *Server) delayed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d := time.Duration(s.delay.Load()); d > 0 {
+			// the request context is only canceled on disconnects once the
+			// body is read
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthURL is the Keystone endpoint, OS_AUTH_URL
+func (s *Server) AuthURL() string {
+	return s.URL + "/v3/"
+}
+
+// Credentials returns OS_* variables of DefaultUser scoped to DefaultProject
+func (s *Server) Credentials() map[string]string {
+	return map[string]string{
+		"OS_AUTH_URL":             s.AuthURL(),
+		"OS_USERNAME":             DefaultUser.Name,
+		"OS_PASSWORD":             DefaultUser.Password,
+		"OS_USER_DOMAIN_NAME":     DefaultDomain.Name,
+		"OS_PROJECT_ID":           DefaultProject.ID,
+		"OS_REGION_NAME":          Region,
+		"OS_IDENTITY_API_VERSION": "3",
+	}
+}
+
+// TakeName makes creating application credentials with the name fail with
+// 409 Conflict, as if the user had one already
+func (s *Server) TakeName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.takenNames[name] = true
+}
+
+// AddSecret stores a Barbican secret
+func (s *Server) AddSecret(id string, payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[id] = payload
+}
+
+// PutObject stores a Swift object in the account of project
+func (s *Server) PutObject(projectID, container, object string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects["AUTH_"+projectID+"/"+container+"/"+object] = data
+}
+
+// ApplicationCredentials returns the application credentials created
+func (s *Server) ApplicationCredentials() []ApplicationCredential {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var acs []ApplicationCredential
+	for _, ac := range s.applicationCredentials {
+		acs = append(acs, *ac)
+	}
+	slices.SortFunc(acs, func(a, b ApplicationCredential) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return acs
+}
+
+// LastTokenRequest returns the identity methods and scope of the last token
+// request
+func (s *Server) LastTokenRequest() TokenRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastTokenRequest
+}
+
+// TokenRequests returns the number of token requests
+func (s *Server) TokenRequests() int {
+	return int(s.tokenRequests.Load())
+}
+
+// ResetTokenRequests resets the number of token requests
+func (s *Server) ResetTokenRequests() {
+	s.tokenRequests.Store(0)
+}
+
+// Conflicts returns the number of application credentials rejected for
+// taken names
+func (s *Server) Conflicts() int {
+	return int(s.conflicts.Load())
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format of Keystone
+func writeError(w http.ResponseWriter, status int, format string, a ...any) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"code": status, "message": fmt.Sprintf(format, a...)},
+	})
+}
+
+// authorized requires a valid X-Auth-Token
+func (s *Server) authorized(next func(http.ResponseWriter, *http.Request, token)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		t, ok := s.tokens[r.Header.Get("X-Auth-Token")]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "The request you have made requires authentication.")
+			return
+		}
+		next(w, r, t)
+	}
+}
@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package openstacktest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/keymanager/v1/secrets"
+	"github.com/gophercloud/gophercloud/v2/openstack/objectstorage/v1/objects"
+)
+
+func authenticate(t *testing.T, s *Server, opts gophercloud.AuthOptions) *gophercloud.ProviderClient {
+	t.Helper()
+	opts.IdentityEndpoint = s.AuthURL()
+	providerClient, err := openstack.AuthenticatedClient(context.TODO(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return providerClient
+}
+
+func passwordAuth() gophercloud.AuthOptions {
+	return gophercloud.AuthOptions{
+		Username:   DefaultUser.Name,
+		Password:   DefaultUser.Password,
+		DomainName: DefaultDomain.Name,
+		Scope:      &gophercloud.AuthScope{ProjectID: DefaultProject.ID},
+	}
+}
+
+func TestApplicationCredentials(t *testing.T) {
+	s := NewServer(t)
+	identityClient, err := openstack.NewIdentityV3(authenticate(t, s, passwordAuth()), gophercloud.EndpointOpts{Region: Region})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Millisecond).UTC()
+	created, err := applicationcredentials.Create(context.TODO(), identityClient, DefaultUser.ID, applicationcredentials.CreateOpts{
+		Name:      "name",
+		ExpiresAt: &expiresAt,
+		Roles:     []applicationcredentials.Role{{Name: MemberRole.Name}},
+	}).Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Secret == "" || created.ProjectID != DefaultProject.ID || !created.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("unexpected application credential %+v", created)
+	}
+	if diff := cmp.Diff([]applicationcredentials.Role{{ID: MemberRole.ID, Name: MemberRole.Name}}, created.Roles); diff != "" {
+		t.Errorf("roles mismatch (-want, +got):\n%s", diff)
+	}
+
+	_, err = applicationcredentials.Create(context.TODO(), identityClient, DefaultUser.ID, applicationcredentials.CreateOpts{Name: "name"}).Extract()
+	if !gophercloud.ResponseCodeIs(err, http.StatusConflict) || s.Conflicts() != 1 {
+		t.Errorf("expected conflict, got %v", err)
+	}
+	_, err = applicationcredentials.Create(context.TODO(), identityClient, DefaultUser.ID, applicationcredentials.CreateOpts{
+		Name:  "other",
+		Roles: []applicationcredentials.Role{{Name: "admin"}},
+	}).Extract()
+	if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		t.Errorf("expected unknown role to be not found, got %v", err)
+	}
+
+	// the credential authenticates, scoped to its project
+	acClient := authenticate(t, s, gophercloud.AuthOptions{
+		ApplicationCredentialID:     created.ID,
+		ApplicationCredentialSecret: created.Secret,
+	})
+	if diff := cmp.Diff([]string{"application_credential"}, s.LastTokenRequest().Methods); diff != "" {
+		t.Errorf("methods mismatch (-want, +got):\n%s", diff)
+	}
+	_, err = openstack.NewIdentityV3(acClient, gophercloud.EndpointOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := applicationcredentials.Get(context.TODO(), identityClient, DefaultUser.ID, created.ID).Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "name" || got.Secret != "" {
+		t.Errorf("unexpected application credential %+v", got)
+	}
+
+	if err := applicationcredentials.Delete(context.TODO(), identityClient, DefaultUser.ID, created.ID).ExtractErr(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.ApplicationCredentials()) != 0 {
+		t.Errorf("application credential should be deleted, got %+v", s.ApplicationCredentials())
+	}
+}
+
+func TestTokens(t *testing.T) {
+	s := NewServer(t)
+
+	tests := map[string]struct {
+		opts       gophercloud.AuthOptions
+		wantStatus int
+	}{
+		"wrong password": {
+			opts: gophercloud.AuthOptions{
+				UserID:   DefaultUser.ID,
+				Password: "wrong",
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"unknown project": {
+			opts: gophercloud.AuthOptions{
+				UserID:   DefaultUser.ID,
+				Password: DefaultUser.Password,
+				Scope:    &gophercloud.AuthScope{ProjectName: "unknown", DomainID: DefaultDomain.ID},
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"project by name": {
+			opts: gophercloud.AuthOptions{
+				UserID:   DefaultUser.ID,
+				Password: DefaultUser.Password,
+				Scope:    &gophercloud.AuthScope{ProjectName: OtherProject.Name, DomainID: DefaultDomain.ID},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.opts.IdentityEndpoint = s.AuthURL()
+			_, err := openstack.AuthenticatedClient(context.TODO(), tc.opts)
+			if tc.wantStatus != 0 {
+				if !gophercloud.ResponseCodeIs(err, tc.wantStatus) {
+					t.Fatalf("expected status %d, got %v", tc.wantStatus, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	s := NewServer(t)
+	s.AddSecret("secret-id", []byte("payload"))
+	keyManagerClient, err := openstack.NewKeyManagerV1(authenticate(t, s, passwordAuth()), gophercloud.EndpointOpts{Region: Region})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := secrets.Get(context.TODO(), keyManagerClient, "secret-id").Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Status != "ACTIVE" {
+		t.Errorf("unexpected secret %+v", secret)
+	}
+	payload, err := secrets.GetPayload(context.TODO(), keyManagerClient, "secret-id", nil).Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "payload" {
+		t.Errorf("expected payload, got %q", payload)
+	}
+	if _, err := secrets.Get(context.TODO(), keyManagerClient, "unknown").Extract(); !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	s := NewServer(t)
+	s.PutObject(DefaultProject.ID, "container", "path/to/object", []byte("data"))
+	objectStorageClient, err := openstack.NewObjectStorageV1(authenticate(t, s, passwordAuth()), gophercloud.EndpointOpts{Region: Region})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := objects.Download(context.TODO(), objectStorageClient, "container", "path/to/object", nil)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	defer result.Body.Close()
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" {
+		t.Errorf("expected data, got %q", data)
+	}
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package openstacktest
+
+import (
+	"net/http"
+)
+
+func (s *Server) getSecret(w http.ResponseWriter, r *http.Request, t token) {
+	s.mu.Lock()
+	_, ok := s.secrets[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found. Sorry but your secret is in another castle.")
+		return
+	}
+	ref := s.URL + "/key-manager/v1/secrets/" + r.PathValue("id")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"secret_ref":    ref,
+		"name":          r.PathValue("id"),
+		"status":        "ACTIVE",
+		"secret_type":   "opaque",
+		"content_types": map[string]string{"default": "application/octet-stream"},
+	})
+}
+
+func (s *Server) getSecretPayload(w http.ResponseWriter, r *http.Request, t token) {
+	s.mu.Lock()
+	payload, ok := s.secrets[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found. Sorry but your secret is in another castle.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(payload)
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, t token) {
+	if t.project == nil || r.PathValue("account") != "AUTH_"+t.project.ID {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	data, ok := s.objects[r.PathValue("account")+"/"+r.PathValue("container")+"/"+r.PathValue("object")]
+	s.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package policy restricts what SecretProviderClasses of a namespace may
+// request from the provider.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const Version = "v1"
+
+// Policy is a list of rules, the first rule matching the namespace and the
+// service account of a Pod applies. Requests matching no rule are denied.
+//
+//	version: v1
+//	rules:
+//	- namespaces: ["team-*"]
+//	  serviceAccounts: ["default"]
+//	  allowedRoles: ["member", "reader"]
+//	  maxExpiresIn: 24h
+//	  allowedObjectTypes: ["applicationCredentials"]
+//	  allowedProjects: ["team-a-*"]
+type Policy struct {
+	Version string `json:"version"`
+	Rules   []Rule `json:"rules"`
+}
+
+type Rule struct {
+	// Namespaces are path.Match patterns, the rule matches any namespace if
+	// empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// ServiceAccounts are path.Match patterns, the rule matches any service
+	// account if empty
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+	// AllowedRoles are names or IDs of roles which may be delegated to
+	// application credentials. If set, every application credential must
+	// list its roles explicitly. Any roles are allowed if empty.
+	AllowedRoles []string `json:"allowedRoles,omitempty"`
+	// MaxExpiresIn is the longest lifetime of application credentials, e.g.
+	// 24h. Not limited if empty.
+	MaxExpiresIn string `json:"maxExpiresIn,omitempty"`
+	// AllowedObjectTypes are SecretProviderClass attributes which may be
+	// used, e.g. applicationCredentials. Any are allowed if empty.
+	AllowedObjectTypes []string `json:"allowedObjectTypes,omitempty"`
+	// AllowDefaultCredentials allows Pods without nodePublishSecretRef to use
+	// the provider default credentials
+	AllowDefaultCredentials bool `json:"allowDefaultCredentials,omitempty"`
+	// AllowedTrustIDs are path.Match patterns of Keystone trust IDs which
+	// Pods may use with the default credentials. No trusts are allowed if
+	// empty.
+	AllowedTrustIDs []string `json:"allowedTrustIDs,omitempty"`
+	// AllowedProjects are path.Match patterns of projectID or projectName
+	// objects may re-scope the credentials to. With the default credentials
+	// no project may be set if empty, otherwise any project is allowed.
+	AllowedProjects []string `json:"allowedProjects,omitempty"`
+	// AllowedClouds and AllowedRegions are path.Match patterns of clouds and
+	// regions objects may select. Any are allowed if empty.
+	AllowedClouds  []string `json:"allowedClouds,omitempty"`
+	AllowedRegions []string `json:"allowedRegions,omitempty"`
+	// Allowed Barbican secret IDs and name patterns are deferred until the
+	// provider serves Barbican secrets
+
+	maxExpiresIn time.Duration
+}
+
+// Request describes a single object requested by a Pod
+type Request struct {
+	Namespace      string
+	ServiceAccount string
+	// ObjectType is the SecretProviderClass attribute the object is defined
+	// in, e.g. applicationCredentials
+	ObjectType string
+	Roles      []string
+	ExpiresIn  time.Duration
+	// DefaultCredentials is set when the provider default credentials are
+	// requested
+	DefaultCredentials bool
+	// TrustID is the Keystone trust to use with the default credentials
+	TrustID string
+	// Project is the projectID or projectName the credentials are re-scoped
+	// to, empty if their scope is used as is
+	Project string
+	Cloud   string
+	Region  string
+}
+
+// Parse parses and validates the policy
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, err
+	}
+	if p.Version != Version {
+		return nil, fmt.Errorf("unsupported policy version %q, should be %s", p.Version, Version)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		for _, pattern := range slices.Concat(rule.Namespaces, rule.ServiceAccounts, rule.AllowedTrustIDs, rule.AllowedProjects, rule.AllowedClouds, rule.AllowedRegions) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rules[%d]: invalid pattern %q, error: %w", i, pattern, err)
+			}
+		}
+		if rule.MaxExpiresIn != "" {
+			d, err := time.ParseDuration(rule.MaxExpiresIn)
+			if err != nil {
+				return nil, fmt.Errorf("rules[%d]: invalid maxExpiresIn, error: %w", i, err)
+			}
+			if d <= 0 {
+				return nil, fmt.Errorf("rules[%d]: maxExpiresIn should be positive", i)
+			}
+			rule.maxExpiresIn = d
+		}
+	}
+	return &p, nil
+}
+
+// Load reads and parses the policy file
+func Load(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s, error: %w", filename, err)
+	}
+	return p, nil
+}
+
+// Authorize returns an error explaining why the request is denied, or nil
+func (p *Policy) Authorize(req Request) error {
+	rule := p.match(req.Namespace, req.ServiceAccount)
+	if rule == nil {
+		return fmt.Errorf("no policy rule allows namespace %q and service account %q", req.Namespace, req.ServiceAccount)
+	}
+	return rule.authorize(req)
+}
+
+func (p *Policy) match(namespace, serviceAccount string) *Rule {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if matchAny(rule.Namespaces, namespace) && matchAny(rule.ServiceAccounts, serviceAccount) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (r *Rule) authorize(req Request) error {
+	if req.DefaultCredentials && !r.AllowDefaultCredentials {
+		return fmt.Errorf("default credentials are not allowed, nodePublishSecretRef should be provided")
+	}
+	if req.DefaultCredentials && req.TrustID != "" && (len(r.AllowedTrustIDs) == 0 || !matchAny(r.AllowedTrustIDs, req.TrustID)) {
+		return fmt.Errorf("trust %q is not allowed", req.TrustID)
+	}
+	// the default credentials may be a member of projects of other teams
+	if req.Project != "" && ((req.DefaultCredentials && len(r.AllowedProjects) == 0) || !matchAny(r.AllowedProjects, req.Project)) {
+		return fmt.Errorf("project %q is not allowed", req.Project)
+	}
+	if req.Cloud != "" && !matchAny(r.AllowedClouds, req.Cloud) {
+		return fmt.Errorf("cloud %q is not allowed", req.Cloud)
+	}
+	if req.Region != "" && !matchAny(r.AllowedRegions, req.Region) {
+		return fmt.Errorf("region %q is not allowed", req.Region)
+	}
+	if len(r.AllowedObjectTypes) > 0 && !slices.Contains(r.AllowedObjectTypes, req.ObjectType) {
+		return fmt.Errorf("object type %s is not allowed", req.ObjectType)
+	}
+	if len(r.AllowedRoles) > 0 {
+		if len(req.Roles) == 0 {
+			return fmt.Errorf("roles should be specified, allowed roles are %v", r.AllowedRoles)
+		}
+		for _, role := range req.Roles {
+			if !slices.Contains(r.AllowedRoles, role) {
+				return fmt.Errorf("role %q is not allowed, allowed roles are %v", role, r.AllowedRoles)
+			}
+		}
+	}
+	if r.maxExpiresIn > 0 && req.ExpiresIn > r.maxExpiresIn {
+		return fmt.Errorf("expiresIn %s exceeds maximum of %s", req.ExpiresIn, r.maxExpiresIn)
+	}
+	return nil
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Store holds the current policy, replaced when the policy file changes. A
+// nil *Store, or a Store without a policy, allows everything but the use of
+// default credentials.
+type Store struct {
+	policy atomic.Pointer[Policy]
+}
+
+func NewStore(p *Policy) *Store {
+	s := &Store{}
+	s.policy.Store(p)
+	return s
+}
+
+// Authorize authorizes the request against the current policy
+func (s *Store) Authorize(req Request) error {
+	var p *Policy
+	if s != nil {
+		p = s.policy.Load()
+	}
+	if p == nil {
+		if req.DefaultCredentials {
+			return fmt.Errorf("default credentials require a policy")
+		}
+		return nil
+	}
+	return p.Authorize(req)
+}
+
+// Watch reloads the policy file into the store whenever its contents change,
+// checking every interval until ctx is done. The file is read on the first
+// check regardless, so changes made before Watch started are not missed.
+// Invalid policies are logged and the previous policy is kept.
+func (s *Store) Watch(ctx context.Context, filename string, interval time.Duration) {
+	var previous []byte
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			slog.Error("Failed to read policy", "file", filename, "error", err)
+			continue
+		}
+		if bytes.Equal(data, previous) {
+			continue
+		}
+		previous = data
+
+		p, err := Parse(data)
+		if err != nil {
+			slog.Error("Invalid policy, keeping the previous one", "file", filename, "error", err)
+			continue
+		}
+		s.policy.Store(p)
+		slog.Info("Reloaded policy", "file", filename)
+	}
+}
@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPolicy = `
+version: v1
+rules:
+- namespaces: ["kube-*"]
+  allowedObjectTypes: []
+  allowedRoles: ["none"]
+- namespaces: ["team-a"]
+  serviceAccounts: ["app", "worker-*"]
+  allowedRoles: ["member", "reader"]
+  maxExpiresIn: 24h
+  allowedObjectTypes: ["applicationCredentials"]
+- namespaces: ["team-b"]
+  allowDefaultCredentials: true
+  allowedTrustIDs: ["0a1b*"]
+- namespaces: ["team-c"]
+  allowDefaultCredentials: true
+  allowedProjects: ["team-c-*"]
+  allowedClouds: ["east"]
+  allowedRegions: ["RegionOne"]
+`
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		policy  string
+		wantErr string
+	}{
+		"valid":                   {policy: testPolicy},
+		"no rules":                {policy: "version: v1"},
+		"missing version":         {policy: "rules: []", wantErr: `unsupported policy version ""`},
+		"unknown field":           {policy: "version: v1\nrules:\n- namespace: [a]", wantErr: `unknown field "namespace"`},
+		"invalid pattern":         {policy: "version: v1\nrules:\n- namespaces: ['[']", wantErr: `rules[0]: invalid pattern "["`},
+		"invalid project pattern": {policy: "version: v1\nrules:\n- allowedProjects: ['[']", wantErr: `rules[0]: invalid pattern "["`},
+		"invalid duration":        {policy: "version: v1\nrules:\n- maxExpiresIn: 1 day", wantErr: "rules[0]: invalid maxExpiresIn"},
+		"negative duration":       {policy: "version: v1\nrules:\n- maxExpiresIn: -1h", wantErr: "rules[0]: maxExpiresIn should be positive"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(test.policy))
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		req     Request
+		wantErr string
+	}{
+		"allowed": {
+			req: Request{Namespace: "team-a", ServiceAccount: "app", ObjectType: "applicationCredentials", Roles: []string{"member"}, ExpiresIn: time.Hour},
+		},
+		"allowed service account pattern": {
+			req: Request{Namespace: "team-a", ServiceAccount: "worker-1", ObjectType: "applicationCredentials", Roles: []string{"member", "reader"}, ExpiresIn: 24 * time.Hour},
+		},
+		"unrestricted rule": {
+			req: Request{Namespace: "team-b", ServiceAccount: "any", ObjectType: "secrets", ExpiresIn: 1000 * time.Hour},
+		},
+		"default credentials not allowed": {
+			req:     Request{Namespace: "team-a", ServiceAccount: "app", ObjectType: "applicationCredentials", Roles: []string{"member"}, DefaultCredentials: true},
+			wantErr: "default credentials are not allowed",
+		},
+		"default credentials allowed": {
+			req: Request{Namespace: "team-b", ServiceAccount: "app", DefaultCredentials: true},
+		},
+		"trust allowed": {
+			req: Request{Namespace: "team-b", ServiceAccount: "app", DefaultCredentials: true, TrustID: "0a1b2c"},
+		},
+		"trust not allowed": {
+			req:     Request{Namespace: "team-b", ServiceAccount: "app", DefaultCredentials: true, TrustID: "ffff"},
+			wantErr: `trust "ffff" is not allowed`,
+		},
+		"project with credentials of the Secret": {
+			req: Request{Namespace: "team-a", ServiceAccount: "app", ObjectType: "applicationCredentials", Roles: []string{"member"}, Project: "any"},
+		},
+		"project with default credentials not allowed": {
+			req:     Request{Namespace: "team-b", ServiceAccount: "app", DefaultCredentials: true, Project: "team-c-prod"},
+			wantErr: `project "team-c-prod" is not allowed`,
+		},
+		"allowed project with default credentials": {
+			req: Request{Namespace: "team-c", ServiceAccount: "app", DefaultCredentials: true, Project: "team-c-prod"},
+		},
+		"other project with default credentials": {
+			req:     Request{Namespace: "team-c", ServiceAccount: "app", DefaultCredentials: true, Project: "team-a-prod"},
+			wantErr: `project "team-a-prod" is not allowed`,
+		},
+		"allowed cloud and region": {
+			req: Request{Namespace: "team-c", ServiceAccount: "app", Cloud: "east", Region: "RegionOne"},
+		},
+		"cloud not allowed": {
+			req:     Request{Namespace: "team-c", ServiceAccount: "app", Cloud: "west"},
+			wantErr: `cloud "west" is not allowed`,
+		},
+		"region not allowed": {
+			req:     Request{Namespace: "team-c", ServiceAccount: "app", Region: "RegionTwo"},
+			wantErr: `region "RegionTwo" is not allowed`,
+		},
+		"first matching rule applies": {
+			req:     Request{Namespace: "kube-system", ServiceAccount: "default", ObjectType: "applicationCredentials", Roles: []string{"member"}},
+			wantErr: `role "member" is not allowed`,
+		},
+		"no matching namespace": {
+			req:     Request{Namespace: "team-d", ServiceAccount: "app"},
+			wantErr: `no policy rule allows namespace "team-d" and service account "app"`,
+		},
+		"no matching service account": {
+			req:     Request{Namespace: "team-a", ServiceAccount: "default"},
+			wantErr: `no policy rule allows namespace "team-a" and service account "default"`,
+		},
+		"object type not allowed": {
+			req:     Request{Namespace: "team-a", ServiceAccount: "app", ObjectType: "secrets"},
+			wantErr: "object type secrets is not allowed",
+		},
+		"roles not specified": {
+			req:     Request{Namespace: "team-a", ServiceAccount: "app", ObjectType: "applicationCredentials", ExpiresIn: time.Hour},
+			wantErr: "roles should be specified",
+		},
+		"role not allowed": {
+			req:     Request{Namespace: "team-a", ServiceAccount: "app", ObjectType: "applicationCredentials", Roles: []string{"member", "admin"}, ExpiresIn: time.Hour},
+			wantErr: `role "admin" is not allowed`,
+		},
+		"expiry exceeded": {
+			req:     Request{Namespace: "team-a", ServiceAccount: "app", ObjectType: "applicationCredentials", Roles: []string{"member"}, ExpiresIn: 25 * time.Hour},
+			wantErr: "expiresIn 25h0m0s exceeds maximum of 24h0m0s",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := p.Authorize(test.req)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStoreWithoutPolicyAllowsEverything(t *testing.T) {
+	var nilStore *Store
+	if err := nilStore.Authorize(Request{Namespace: "any"}); err != nil {
+		t.Errorf("nil store should allow everything, got %v", err)
+	}
+	if err := NewStore(nil).Authorize(Request{Namespace: "any"}); err != nil {
+		t.Errorf("empty store should allow everything, got %v", err)
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(policy string) {
+		t.Helper()
+		if err := os.WriteFile(filename, []byte(policy), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually := func(condition func() bool) {
+		t.Helper()
+		for range 100 {
+			if condition() {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("condition not met in time")
+	}
+
+	write("version: v1\nrules:\n- namespaces: [team-a]")
+	p, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, filename, 5*time.Millisecond)
+
+	teamB := Request{Namespace: "team-b"}
+	if err := store.Authorize(teamB); err == nil {
+		t.Fatal("team-b should be denied by the initial policy")
+	}
+
+	write("version: v1\nrules:\n- namespaces: [team-b]")
+	eventually(func() bool { return store.Authorize(teamB) == nil })
+
+	// invalid policy keeps the previous one
+	write("version: v2")
+	time.Sleep(50 * time.Millisecond)
+	if err := store.Authorize(teamB); err != nil {
+		t.Fatalf("previous policy should be kept, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2"
+)
+
+// authMethods maps OS_AUTH_TYPE values to the authentication method
+var authMethods = map[string]string{
+	"password":                "password",
+	"v3password":              "password",
+	"v3totp":                  "totp",
+	"v3multifactor":           "multifactor",
+	"token":                   "token",
+	"v3token":                 "token",
+	"v3applicationcredential": "applicationcredential",
+}
+
+// MissingKeysError lists credentials required by the auth type, every item
+// holding alternative keys of which one is required
+type MissingKeysError struct {
+	AuthType string
+	Keys     [][]string
+}
+
+func (e MissingKeysError) Error() string {
+	keys := make([]string, len(e.Keys))
+	for i, alternatives := range e.Keys {
+		keys[i] = strings.Join(alternatives, " or ")
+	}
+	return fmt.Sprintf("auth type %s requires %s", e.AuthType, strings.Join(keys, "; "))
+}
+
+// AuthOptionsFromMap returns gophercloud.AuthOptions for input map which items
+// represent OS_* environment variable names and values, following the
+// conventions of the OpenStack CLI:
+//   - OS_AUTH_TYPE selects the authentication method, which is otherwise
+//     inferred from the credentials present
+//   - OS_USER_DOMAIN_* and OS_PROJECT_DOMAIN_* set the domains of the user and
+//     of the project, OS_DOMAIN_* and then OS_DEFAULT_DOMAIN_* are the
+//     fallbacks for both; OS_DOMAIN_* scopes the token to the domain if no
+//     project is set, unless it stands in for the domain of the user
+//   - OS_TRUST_ID and OS_SYSTEM_SCOPE take precedence over project scope, and
+//     application credentials are never scoped, as Keystone binds them to
+//     their project
+//
+// Like openstack.AuthOptionsFromEnv, OS_USERID, OS_TENANT_ID and
+// OS_TENANT_NAME are accepted as aliases.
+func AuthOptionsFromMap(authMap map[string]string) (gophercloud.AuthOptions, error) {
+	// get returns the first value set of keys
+	get := func(keys ...string) string {
+		for _, k := range keys {
+			if v := authMap[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	authURL := get("OS_AUTH_URL")
+	userID := get("OS_USER_ID", "OS_USERID")
+	username := get("OS_USERNAME")
+	password := get("OS_PASSWORD")
+	passcode := get("OS_PASSCODE")
+	token := get("OS_TOKEN")
+	applicationCredentialID := get("OS_APPLICATION_CREDENTIAL_ID")
+	applicationCredentialName := get("OS_APPLICATION_CREDENTIAL_NAME")
+	applicationCredentialSecret := get("OS_APPLICATION_CREDENTIAL_SECRET")
+	projectID := get("OS_PROJECT_ID", "OS_TENANT_ID")
+	projectName := get("OS_PROJECT_NAME", "OS_TENANT_NAME")
+	userDomainID := get("OS_USER_DOMAIN_ID", "OS_DOMAIN_ID", "OS_DEFAULT_DOMAIN_ID")
+	userDomainName := get("OS_USER_DOMAIN_NAME", "OS_DOMAIN_NAME", "OS_DEFAULT_DOMAIN_NAME")
+	projectDomainID := get("OS_PROJECT_DOMAIN_ID", "OS_DOMAIN_ID", "OS_DEFAULT_DOMAIN_ID")
+	projectDomainName := get("OS_PROJECT_DOMAIN_NAME", "OS_DOMAIN_NAME", "OS_DEFAULT_DOMAIN_NAME")
+	domainID := get("OS_DOMAIN_ID")
+	domainName := get("OS_DOMAIN_NAME")
+	systemScope := get("OS_SYSTEM_SCOPE")
+	trustID := get("OS_TRUST_ID")
+
+	if cloud := get("OS_CLOUD"); cloud != "" && authURL == "" {
+		return gophercloud.AuthOptions{}, fmt.Errorf("OS_CLOUD is set to %q, but no clouds.yaml provides it", cloud)
+	}
+	if v := get("OS_IDENTITY_API_VERSION"); v != "" && v != "3" && !strings.HasPrefix(v, "3.") {
+		return gophercloud.AuthOptions{}, fmt.Errorf("unsupported OS_IDENTITY_API_VERSION %q, only 3 is supported", v)
+	}
+
+	authType := get("OS_AUTH_TYPE")
+	if authType == "" {
+		switch {
+		case applicationCredentialID != "" || applicationCredentialName != "":
+			authType = "v3applicationcredential"
+		case password != "" && passcode != "":
+			authType = "v3multifactor"
+		case passcode != "":
+			authType = "v3totp"
+		case token != "" && password == "":
+			authType = "v3token"
+		default:
+			authType = "password"
+		}
+	}
+	method, ok := authMethods[authType]
+	if !ok {
+		return gophercloud.AuthOptions{}, fmt.Errorf("unsupported OS_AUTH_TYPE %q, supported are %s", authType, strings.Join(slices.Sorted(maps.Keys(authMethods)), ", "))
+	}
+
+	var missing [][]string
+	require := func(set bool, alternatives ...string) {
+		if !set {
+			missing = append(missing, alternatives)
+		}
+	}
+
+	ao := gophercloud.AuthOptions{
+		IdentityEndpoint: authURL,
+		// unscoped unless set below, gophercloud would otherwise derive a scope
+		Scope: &gophercloud.AuthScope{},
+	}
+	require(authURL != "", "OS_AUTH_URL")
+
+	// userDomainFallback is set when OS_DOMAIN_* stands in for the domain of
+	// the user, which then does not scope the token
+	userDomainFallback := false
+	// user sets the user, which domain is only needed with its name
+	user := func() {
+		require(userID != "" || username != "", "OS_USER_ID", "OS_USERNAME")
+		if userID != "" {
+			ao.UserID = userID
+			return
+		}
+		if username == "" {
+			return
+		}
+		ao.Username = username
+		require(userDomainID != "" || userDomainName != "", "OS_USER_DOMAIN_ID", "OS_USER_DOMAIN_NAME", "OS_DOMAIN_ID", "OS_DOMAIN_NAME", "OS_DEFAULT_DOMAIN_ID", "OS_DEFAULT_DOMAIN_NAME")
+		userDomainFallback = get("OS_USER_DOMAIN_ID", "OS_USER_DOMAIN_NAME") == ""
+		if userDomainID != "" {
+			ao.DomainID = userDomainID
+		} else {
+			ao.DomainName = userDomainName
+		}
+	}
+
+	switch method {
+	case "password", "totp", "multifactor":
+		user()
+		if method != "totp" {
+			require(password != "", "OS_PASSWORD")
+			ao.Password = password
+		}
+		if method != "password" {
+			require(passcode != "", "OS_PASSCODE")
+			ao.Passcode = passcode
+		}
+		// a passcode can not be used again
+		ao.AllowReauth = method == "password"
+	case "token":
+		require(token != "", "OS_TOKEN")
+		ao.TokenID = token
+	case "applicationcredential":
+		require(applicationCredentialID != "" || applicationCredentialName != "", "OS_APPLICATION_CREDENTIAL_ID", "OS_APPLICATION_CREDENTIAL_NAME")
+		require(applicationCredentialSecret != "", "OS_APPLICATION_CREDENTIAL_SECRET")
+		ao.ApplicationCredentialID = applicationCredentialID
+		ao.ApplicationCredentialSecret = applicationCredentialSecret
+		if applicationCredentialID == "" && applicationCredentialName != "" {
+			ao.ApplicationCredentialName = applicationCredentialName
+			user()
+		}
+		ao.AllowReauth = true
+	}
+
+	switch {
+	case trustID != "":
+		// trust-scoped tokens act on behalf of the trustor in the project of
+		// the trust, any other scope is ignored
+		ao.Scope = &gophercloud.AuthScope{TrustID: trustID}
+	case method == "applicationcredential":
+		// bound to their project
+	case systemScope == "all":
+		ao.Scope = &gophercloud.AuthScope{System: true}
+	case projectID != "":
+		ao.Scope = &gophercloud.AuthScope{ProjectID: projectID}
+	case projectName != "":
+		require(projectDomainID != "" || projectDomainName != "", "OS_PROJECT_DOMAIN_ID", "OS_PROJECT_DOMAIN_NAME", "OS_DOMAIN_ID", "OS_DOMAIN_NAME", "OS_DEFAULT_DOMAIN_ID", "OS_DEFAULT_DOMAIN_NAME")
+		ao.Scope = &gophercloud.AuthScope{ProjectName: projectName, DomainID: projectDomainID}
+		if projectDomainID == "" {
+			ao.Scope.DomainName = projectDomainName
+		}
+	case userDomainFallback:
+		// unscoped, Keystone scopes the token to the default project of the
+		// user
+	case domainID != "":
+		ao.Scope = &gophercloud.AuthScope{DomainID: domainID}
+	case domainName != "":
+		ao.Scope = &gophercloud.AuthScope{DomainName: domainName}
+	}
+
+	if len(missing) > 0 {
+		return gophercloud.AuthOptions{}, MissingKeysError{AuthType: authType, Keys: missing}
+	}
+	return ao, nil
+}
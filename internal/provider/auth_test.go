@@ -0,0 +1,415 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gophercloud/gophercloud/v2"
+)
+
+func TestAuthOptionsFromMap(t *testing.T) {
+	const authURL = "http://localhost:5000/v3/"
+
+	tests := map[string]struct {
+		authMap map[string]string
+		want    gophercloud.AuthOptions
+		wantErr string
+	}{
+		"password with split domains": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":             authURL,
+				"OS_USERNAME":             "user",
+				"OS_PASSWORD":             "password",
+				"OS_USER_DOMAIN_NAME":     "Users",
+				"OS_PROJECT_NAME":         "demo",
+				"OS_PROJECT_DOMAIN_ID":    "projects",
+				"OS_IDENTITY_API_VERSION": "3",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				Username:         "user",
+				Password:         "password",
+				DomainName:       "Users",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{ProjectName: "demo", DomainID: "projects"},
+			},
+		},
+		"password with OS_DOMAIN_ID for user and project": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":     authURL,
+				"OS_AUTH_TYPE":    "v3password",
+				"OS_USERNAME":     "user",
+				"OS_PASSWORD":     "password",
+				"OS_DOMAIN_ID":    "default",
+				"OS_PROJECT_NAME": "demo",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				Username:         "user",
+				Password:         "password",
+				DomainID:         "default",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{ProjectName: "demo", DomainID: "default"},
+			},
+		},
+		"password with user ID ignores user domain": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":         authURL,
+				"OS_USER_ID":          "user-id",
+				"OS_PASSWORD":         "password",
+				"OS_USER_DOMAIN_NAME": "Default",
+				"OS_PROJECT_ID":       "project-id",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				UserID:           "user-id",
+				Password:         "password",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{ProjectID: "project-id"},
+			},
+		},
+		"legacy aliases": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":    authURL,
+				"OS_USERID":      "user-id",
+				"OS_PASSWORD":    "password",
+				"OS_TENANT_ID":   "project-id",
+				"OS_TENANT_NAME": "ignored",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				UserID:           "user-id",
+				Password:         "password",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{ProjectID: "project-id"},
+			},
+		},
+		"domain of the user": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":    authURL,
+				"OS_USERNAME":    "user",
+				"OS_PASSWORD":    "password",
+				"OS_DOMAIN_NAME": "Default",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				Username:         "user",
+				Password:         "password",
+				DomainName:       "Default",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{},
+			},
+		},
+		"domain scope": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":         authURL,
+				"OS_USERNAME":         "user",
+				"OS_PASSWORD":         "password",
+				"OS_USER_DOMAIN_NAME": "Default",
+				"OS_DOMAIN_NAME":      "other",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				Username:         "user",
+				Password:         "password",
+				DomainName:       "Default",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{DomainName: "other"},
+			},
+		},
+		"default domain": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":          authURL,
+				"OS_USERNAME":          "user",
+				"OS_PASSWORD":          "password",
+				"OS_PROJECT_NAME":      "project",
+				"OS_DEFAULT_DOMAIN_ID": "default",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				Username:         "user",
+				Password:         "password",
+				DomainID:         "default",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{ProjectName: "project", DomainID: "default"},
+			},
+		},
+		"unscoped": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":       authURL,
+				"OS_USERNAME":       "user",
+				"OS_PASSWORD":       "password",
+				"OS_USER_DOMAIN_ID": "default",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				Username:         "user",
+				Password:         "password",
+				DomainID:         "default",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{},
+			},
+		},
+		"system scope": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":     authURL,
+				"OS_USER_ID":      "user-id",
+				"OS_PASSWORD":     "password",
+				"OS_PROJECT_ID":   "project-id",
+				"OS_SYSTEM_SCOPE": "all",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				UserID:           "user-id",
+				Password:         "password",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{System: true},
+			},
+		},
+		"trust scope": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":   authURL,
+				"OS_USER_ID":    "user-id",
+				"OS_PASSWORD":   "password",
+				"OS_PROJECT_ID": "project-id",
+				"OS_TRUST_ID":   "trust-id",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				UserID:           "user-id",
+				Password:         "password",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{TrustID: "trust-id"},
+			},
+		},
+		"token inferred": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":   authURL,
+				"OS_TOKEN":      "token",
+				"OS_USERNAME":   "ignored",
+				"OS_PROJECT_ID": "project-id",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				TokenID:          "token",
+				Scope:            &gophercloud.AuthScope{ProjectID: "project-id"},
+			},
+		},
+		"token selected over password": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":  authURL,
+				"OS_AUTH_TYPE": "token",
+				"OS_TOKEN":     "token",
+				"OS_PASSWORD":  "ignored",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				TokenID:          "token",
+				Scope:            &gophercloud.AuthScope{},
+			},
+		},
+		"totp inferred": {
+			authMap: map[string]string{
+				"OS_AUTH_URL": authURL,
+				"OS_USER_ID":  "user-id",
+				"OS_PASSCODE": "123456",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				UserID:           "user-id",
+				Passcode:         "123456",
+				Scope:            &gophercloud.AuthScope{},
+			},
+		},
+		"multifactor inferred": {
+			authMap: map[string]string{
+				"OS_AUTH_URL": authURL,
+				"OS_USER_ID":  "user-id",
+				"OS_PASSWORD": "password",
+				"OS_PASSCODE": "123456",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				UserID:           "user-id",
+				Password:         "password",
+				Passcode:         "123456",
+				Scope:            &gophercloud.AuthScope{},
+			},
+		},
+		"password ignores passcode": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":  authURL,
+				"OS_AUTH_TYPE": "password",
+				"OS_USER_ID":   "user-id",
+				"OS_PASSWORD":  "password",
+				"OS_PASSCODE":  "123456",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint: authURL,
+				UserID:           "user-id",
+				Password:         "password",
+				AllowReauth:      true,
+				Scope:            &gophercloud.AuthScope{},
+			},
+		},
+		"application credential ID is not scoped": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":                      authURL,
+				"OS_AUTH_TYPE":                     "v3applicationcredential",
+				"OS_APPLICATION_CREDENTIAL_ID":     "id",
+				"OS_APPLICATION_CREDENTIAL_SECRET": "secret",
+				"OS_USERNAME":                      "ignored",
+				"OS_PROJECT_ID":                    "ignored",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint:            authURL,
+				ApplicationCredentialID:     "id",
+				ApplicationCredentialSecret: "secret",
+				AllowReauth:                 true,
+				Scope:                       &gophercloud.AuthScope{},
+			},
+		},
+		"application credential name": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":                      authURL,
+				"OS_APPLICATION_CREDENTIAL_NAME":   "name",
+				"OS_APPLICATION_CREDENTIAL_SECRET": "secret",
+				"OS_USERNAME":                      "user",
+				"OS_USER_DOMAIN_ID":                "default",
+			},
+			want: gophercloud.AuthOptions{
+				IdentityEndpoint:            authURL,
+				ApplicationCredentialName:   "name",
+				ApplicationCredentialSecret: "secret",
+				Username:                    "user",
+				DomainID:                    "default",
+				AllowReauth:                 true,
+				Scope:                       &gophercloud.AuthScope{},
+			},
+		},
+		"empty": {
+			authMap: map[string]string{},
+			wantErr: "auth type password requires OS_AUTH_URL; OS_USER_ID or OS_USERNAME; OS_PASSWORD",
+		},
+		"username without domain": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":     authURL,
+				"OS_USERNAME":     "user",
+				"OS_PASSWORD":     "password",
+				"OS_PROJECT_NAME": "demo",
+			},
+			wantErr: "auth type password requires OS_USER_DOMAIN_ID or OS_USER_DOMAIN_NAME or OS_DOMAIN_ID or OS_DOMAIN_NAME or OS_DEFAULT_DOMAIN_ID or OS_DEFAULT_DOMAIN_NAME; OS_PROJECT_DOMAIN_ID or OS_PROJECT_DOMAIN_NAME or OS_DOMAIN_ID or OS_DOMAIN_NAME or OS_DEFAULT_DOMAIN_ID or OS_DEFAULT_DOMAIN_NAME",
+		},
+		"project name without project domain": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":         authURL,
+				"OS_USERNAME":         "user",
+				"OS_PASSWORD":         "password",
+				"OS_USER_DOMAIN_NAME": "Default",
+				"OS_PROJECT_NAME":     "demo",
+			},
+			wantErr: "auth type password requires OS_PROJECT_DOMAIN_ID or OS_PROJECT_DOMAIN_NAME or OS_DOMAIN_ID or OS_DOMAIN_NAME or OS_DEFAULT_DOMAIN_ID or OS_DEFAULT_DOMAIN_NAME",
+		},
+		"token without OS_TOKEN": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":  authURL,
+				"OS_AUTH_TYPE": "v3token",
+			},
+			wantErr: "auth type v3token requires OS_TOKEN",
+		},
+		"totp without passcode": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":  authURL,
+				"OS_AUTH_TYPE": "v3totp",
+				"OS_USER_ID":   "user-id",
+			},
+			wantErr: "auth type v3totp requires OS_PASSCODE",
+		},
+		"multifactor without password": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":  authURL,
+				"OS_AUTH_TYPE": "v3multifactor",
+				"OS_USER_ID":   "user-id",
+				"OS_PASSCODE":  "123456",
+			},
+			wantErr: "auth type v3multifactor requires OS_PASSWORD",
+		},
+		"application credential without secret": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":                  authURL,
+				"OS_APPLICATION_CREDENTIAL_ID": "id",
+			},
+			wantErr: "auth type v3applicationcredential requires OS_APPLICATION_CREDENTIAL_SECRET",
+		},
+		"application credential name without user": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":                      authURL,
+				"OS_APPLICATION_CREDENTIAL_NAME":   "name",
+				"OS_APPLICATION_CREDENTIAL_SECRET": "secret",
+			},
+			wantErr: "auth type v3applicationcredential requires OS_USER_ID or OS_USERNAME",
+		},
+		"application credential type without credential": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":  authURL,
+				"OS_AUTH_TYPE": "v3applicationcredential",
+			},
+			wantErr: "auth type v3applicationcredential requires OS_APPLICATION_CREDENTIAL_ID or OS_APPLICATION_CREDENTIAL_NAME; OS_APPLICATION_CREDENTIAL_SECRET",
+		},
+		"unsupported auth type": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":  authURL,
+				"OS_AUTH_TYPE": "v3oidcpassword",
+			},
+			wantErr: `unsupported OS_AUTH_TYPE "v3oidcpassword", supported are password, token, v3applicationcredential, v3multifactor, v3password, v3token, v3totp`,
+		},
+		"OS_CLOUD without clouds.yaml": {
+			authMap: map[string]string{
+				"OS_CLOUD": "openstack",
+			},
+			wantErr: `OS_CLOUD is set to "openstack", but no clouds.yaml provides it`,
+		},
+		"identity API v2": {
+			authMap: map[string]string{
+				"OS_AUTH_URL":             authURL,
+				"OS_IDENTITY_API_VERSION": "2",
+			},
+			wantErr: `unsupported OS_IDENTITY_API_VERSION "2", only 3 is supported`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := AuthOptionsFromMap(tc.authMap)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("AuthOptions mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAuthOptionsFromMapMissingKeysError(t *testing.T) {
+	_, err := AuthOptionsFromMap(map[string]string{"OS_AUTH_TYPE": "token"})
+	var missingKeysError MissingKeysError
+	if !errors.As(err, &missingKeysError) {
+		t.Fatalf("expected MissingKeysError, got %v", err)
+	}
+	want := [][]string{{"OS_AUTH_URL"}, {"OS_TOKEN"}}
+	if diff := cmp.Diff(want, missingKeysError.Keys); diff != "" {
+		t.Errorf("keys mismatch (-want, +got):\n%s", diff)
+	}
+}
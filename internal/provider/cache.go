@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+)
+
+// tokenExpiryMargin is how long before the token expires a cached provider
+// client is no longer used
+const tokenExpiryMargin = 5 * time.Minute
+
+// clientCache holds authenticated provider clients per credentials and scope,
+// so objects of the same cloud do not authenticate one by one
+type clientCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	providerClient *gophercloud.ProviderClient
+	expiresAt      time.Time
+}
+
+func newClientCache(ttl time.Duration) *clientCache {
+	return &clientCache{
+		ttl:     ttl,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+// cacheKey digests the credentials, so secrets are not kept as map keys
+func cacheKey(auth map[string]string, scope *gophercloud.AuthScope) string {
+	h := sha256.New()
+	for _, k := range slices.Sorted(maps.Keys(auth)) {
+		fmt.Fprintf(h, "%q=%q\n", k, auth[k])
+	}
+	if scope != nil {
+		fmt.Fprintf(h, "scope=%+v\n", *scope)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *clientCache) get(key string) *gophercloud.ProviderClient {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.providerClient
+}
+
+func (c *clientCache) put(key string, providerClient *gophercloud.ProviderClient) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	expiresAt := time.Now().Add(c.ttl)
+	if token, ok := providerClient.GetAuthResult().(tokens.CreateResult); ok {
+		if t, err := token.ExtractToken(); err == nil && !t.ExpiresAt.IsZero() && t.ExpiresAt.Add(-tokenExpiryMargin).Before(expiresAt) {
+			expiresAt = t.ExpiresAt.Add(-tokenExpiryMargin)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// drop expired entries, so credentials which are no longer used do not
+	// pile up
+	for k, entry := range c.entries {
+		if time.Now().After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{providerClient: providerClient, expiresAt: expiresAt}
+}
+
+func (c *clientCache) delete(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
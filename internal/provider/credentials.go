@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// CredentialsSource provides credentials in the format accepted by
+// AuthOptionsFromMap, i.e. OS_* environment variable names and values
+type CredentialsSource interface {
+	Credentials() (map[string]string, error)
+}
+
+// CloudsFile reads credentials of the Cloud from a clouds.yaml file on every
+// call, so the file may be updated in place
+type CloudsFile struct {
+	Path  string
+	Cloud string
+}
+
+func (f CloudsFile) Credentials() (map[string]string, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	clouds, err := ParseCloudsYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s, error: %w", f.Path, err)
+	}
+	cloud, ok := clouds[f.Cloud]
+	if !ok {
+		return nil, fmt.Errorf("cloud %q not found in %s", f.Cloud, f.Path)
+	}
+	return cloud, nil
+}
+
+// Environment provides credentials from OS_* environment variables of the
+// provider process
+type Environment struct{}
+
+func (Environment) Credentials() (map[string]string, error) {
+	auth := map[string]string{}
+	for _, env := range os.Environ() {
+		k, v, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(k, "OS_") {
+			auth[k] = v
+		}
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no OS_* environment variables are set")
+	}
+	return auth, nil
+}
+
+type cloudsYAML struct {
+	Clouds map[string]cloudYAML `json:"clouds"`
+}
+
+type cloudYAML struct {
+	Auth               map[string]string `json:"auth"`
+	AuthType           string            `json:"auth_type"`
+	RegionName         string            `json:"region_name"`
+	Interface          string            `json:"interface"`
+	IdentityAPIVersion string            `json:"identity_api_version"`
+}
+
+// cloudsYAMLAuthKeys maps clouds.yaml auth keys to environment variables
+var cloudsYAMLAuthKeys = map[string]string{
+	"auth_url":                      "OS_AUTH_URL",
+	"token":                         "OS_TOKEN",
+	"username":                      "OS_USERNAME",
+	"user_id":                       "OS_USERID",
+	"password":                      "OS_PASSWORD",
+	"passcode":                      "OS_PASSCODE",
+	"project_id":                    "OS_PROJECT_ID",
+	"project_name":                  "OS_PROJECT_NAME",
+	"domain_id":                     "OS_DOMAIN_ID",
+	"domain_name":                   "OS_DOMAIN_NAME",
+	"default_domain_id":             "OS_DEFAULT_DOMAIN_ID",
+	"default_domain_name":           "OS_DEFAULT_DOMAIN_NAME",
+	"user_domain_id":                "OS_USER_DOMAIN_ID",
+	"user_domain_name":              "OS_USER_DOMAIN_NAME",
+	"project_domain_id":             "OS_PROJECT_DOMAIN_ID",
+	"project_domain_name":           "OS_PROJECT_DOMAIN_NAME",
+	"application_credential_id":     "OS_APPLICATION_CREDENTIAL_ID",
+	"application_credential_name":   "OS_APPLICATION_CREDENTIAL_NAME",
+	"application_credential_secret": "OS_APPLICATION_CREDENTIAL_SECRET",
+	"system_scope":                  "OS_SYSTEM_SCOPE",
+	"trust_id":                      "OS_TRUST_ID",
+}
+
+// ParseCloudsYAML returns credentials of every cloud of a clouds.yaml file,
+// keyed by cloud name
+func ParseCloudsYAML(data []byte) (map[string]map[string]string, error) {
+	var c cloudsYAML
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if len(c.Clouds) == 0 {
+		return nil, fmt.Errorf("no clouds defined")
+	}
+
+	clouds := map[string]map[string]string{}
+	for name, cloud := range c.Clouds {
+		auth := map[string]string{}
+		for k, v := range cloud.Auth {
+			env, ok := cloudsYAMLAuthKeys[k]
+			if !ok {
+				return nil, fmt.Errorf("cloud %q: unsupported auth key %q", name, k)
+			}
+			auth[env] = v
+		}
+		for env, v := range map[string]string{
+			"OS_AUTH_TYPE":            cloud.AuthType,
+			"OS_REGION_NAME":          cloud.RegionName,
+			"OS_INTERFACE":            cloud.Interface,
+			"OS_IDENTITY_API_VERSION": cloud.IdentityAPIVersion,
+		} {
+			if v != "" {
+				auth[env] = v
+			}
+		}
+		clouds[name] = auth
+	}
+	return clouds, nil
+}
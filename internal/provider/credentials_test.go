@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testCloudsYAML = `
+clouds:
+  prod:
+    auth:
+      auth_url: https://keystone.prod/v3/
+      username: service
+      password: secret
+      project_name: demo
+      user_domain_name: Default
+      project_domain_id: default
+    region_name: RegionOne
+    interface: internal
+    identity_api_version: 3
+  staging:
+    auth_type: v3applicationcredential
+    auth:
+      auth_url: https://keystone.staging/v3/
+      application_credential_id: abc
+      application_credential_secret: def
+`
+
+func TestParseCloudsYAML(t *testing.T) {
+	clouds, err := ParseCloudsYAML([]byte(testCloudsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{
+		"prod": {
+			"OS_AUTH_URL":             "https://keystone.prod/v3/",
+			"OS_USERNAME":             "service",
+			"OS_PASSWORD":             "secret",
+			"OS_PROJECT_NAME":         "demo",
+			"OS_USER_DOMAIN_NAME":     "Default",
+			"OS_PROJECT_DOMAIN_ID":    "default",
+			"OS_REGION_NAME":          "RegionOne",
+			"OS_INTERFACE":            "internal",
+			"OS_IDENTITY_API_VERSION": "3",
+		},
+		"staging": {
+			"OS_AUTH_TYPE":                     "v3applicationcredential",
+			"OS_AUTH_URL":                      "https://keystone.staging/v3/",
+			"OS_APPLICATION_CREDENTIAL_ID":     "abc",
+			"OS_APPLICATION_CREDENTIAL_SECRET": "def",
+		},
+	}
+	if diff := cmp.Diff(want, clouds); diff != "" {
+		t.Errorf("ParseCloudsYAML() mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestParseCloudsYAMLErrors(t *testing.T) {
+	tests := map[string]struct {
+		data    string
+		wantErr string
+	}{
+		"no clouds":        {data: "clouds: {}", wantErr: "no clouds defined"},
+		"unknown auth key": {data: "clouds:\n  a:\n    auth:\n      secret: x", wantErr: `cloud "a": unsupported auth key "secret"`},
+		"invalid yaml":     {data: "clouds: [", wantErr: "yaml"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCloudsYAML([]byte(test.data))
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCloudsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clouds.yaml")
+	if err := os.WriteFile(path, []byte(testCloudsYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := CloudsFile{Path: path, Cloud: "staging"}.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth["OS_APPLICATION_CREDENTIAL_ID"] != "abc" {
+		t.Errorf("unexpected credentials %v", auth)
+	}
+
+	if _, err := (CloudsFile{Path: path, Cloud: "dev"}).Credentials(); err == nil || !strings.Contains(err.Error(), `cloud "dev" not found`) {
+		t.Errorf("expected missing cloud error, got %v", err)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	t.Setenv("OS_AUTH_URL", "https://keystone/v3/")
+	t.Setenv("OS_PASSWORD", "secret")
+	t.Setenv("NOT_OS_AUTH", "ignored")
+
+	auth, err := Environment{}.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth["OS_AUTH_URL"] != "https://keystone/v3/" || auth["OS_PASSWORD"] != "secret" {
+		t.Errorf("unexpected credentials %v", auth)
+	}
+	if _, ok := auth["NOT_OS_AUTH"]; ok {
+		t.Errorf("non OS_* variables should be ignored, got %v", auth)
+	}
+}
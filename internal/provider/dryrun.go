@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+)
+
+// DryRunClient pretends to create application credentials without contacting
+// OpenStack, returning what the request describes with a placeholder secret
+type DryRunClient struct{}
+
+// DryRunSecret is the secret of application credentials of DryRunClient
+const DryRunSecret = "dry-run-secret"
+
+func (DryRunClient) CreateApplicationCredential(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+	identityClient := &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{},
+		Endpoint:       auth["OS_AUTH_URL"],
+	}
+
+	createMap, err := createOpts.ToApplicationCredentialCreateMap()
+	if err != nil {
+		return nil, identityClient, err
+	}
+	// the request body has the format of the response, except for the
+	// fields Keystone fills in
+	b, err := json.Marshal(createMap)
+	if err != nil {
+		return nil, identityClient, err
+	}
+	var r struct {
+		ApplicationCredential applicationcredentials.ApplicationCredential `json:"application_credential"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, identityClient, fmt.Errorf("failed to decode create request, error: %w", err)
+	}
+
+	applicationCredential := r.ApplicationCredential
+	applicationCredential.ID = "dry-run-" + applicationCredential.Name
+	applicationCredential.Secret = DryRunSecret
+	if scope != nil {
+		applicationCredential.ProjectID = scope.ProjectID
+	}
+	return &applicationCredential, identityClient, nil
+}
+
+// DeleteApplicationCredential does nothing, as no credential was created
+func (DryRunClient) DeleteApplicationCredential(ctx context.Context, identityClient *gophercloud.ServiceClient, id string) error {
+	return nil
+}
@@ -5,8 +5,13 @@
 package provider
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack"
@@ -14,14 +19,62 @@ import (
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
 )
 
+// maxCreateAttempts limits attempts to create an application credential when
+// Keystone reports a name conflict
+const maxCreateAttempts = 3
+
 type ProviderClient interface {
-	CreateApplicationCredential(ctx context.Context, auth map[string]string, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error)
+	// CreateApplicationCredential authenticates with auth and creates an
+	// application credential for the current user. If scope is not nil, the
+	// token is re-scoped to it first.
+	CreateApplicationCredential(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error)
+	// DeleteApplicationCredential deletes an application credential of the
+	// current user of identityClient, as returned by
+	// CreateApplicationCredential
+	DeleteApplicationCredential(ctx context.Context, identityClient *gophercloud.ServiceClient, id string) error
+}
+
+// Client talks to OpenStack. The zero value authenticates on every call,
+// NewClient returns a Client caching authenticated clients.
+type Client struct {
+	cache *clientCache
+	// callTimeout bounds every single OpenStack call, not limited if 0
+	callTimeout time.Duration
 }
 
-type Client struct{}
+type ClientOption func(*Client)
 
-func (c Client) CreateApplicationCredential(ctx context.Context, auth map[string]string, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
-	providerClient, identityClient, err := newGophercloudClients(ctx, auth)
+// WithCallTimeout bounds every single OpenStack call, e.g. authentication or
+// a single attempt to create an application credential, in addition to the
+// deadline of the context passed in
+func WithCallTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.callTimeout = timeout
+	}
+}
+
+// NewClient returns Client caching authenticated clients per credentials and
+// scope for up to cacheTTL, and not past token expiration. Caching is
+// disabled if cacheTTL is 0.
+func NewClient(cacheTTL time.Duration, opts ...ClientOption) Client {
+	c := Client{cache: newClientCache(cacheTTL)}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// callContext returns ctx bounded by the call timeout
+func (c Client) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.callTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.callTimeout)
+}
+
+func (c Client) CreateApplicationCredential(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+	key := cacheKey(auth, scope)
+	providerClient, identityClient, err := c.newGophercloudClients(ctx, auth, scope, key)
 	if err != nil {
 		return nil, identityClient, err
 	}
@@ -35,21 +88,61 @@ func (c Client) CreateApplicationCredential(ctx context.Context, auth map[string
 	if err != nil {
 		return nil, identityClient, err
 	}
-
-	applicationCredential, err := applicationcredentials.Create(ctx, identityClient, currentUser.ID, createOpts).Extract()
+	assignedRoles, err := currentToken.ExtractRoles()
+	if err != nil {
+		return nil, identityClient, err
+	}
+	currentProject, err := currentToken.ExtractProject()
+	if err != nil || currentProject == nil {
+		return nil, identityClient, fmt.Errorf("failed to get project of current token, error: %w", cmp.Or(err, errors.New("token is not project scoped")))
+	}
+	createOpts = roleResolvingCreateOpts{CreateOptsBuilder: createOpts, assigned: assignedRoles, project: *currentProject}
+
+	// names are generated by createOpts on every call, so a name clashing with
+	// an existing credential of the user is simply retried with a fresh one
+	var applicationCredential *applicationcredentials.ApplicationCredential
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := c.callContext(ctx)
+		applicationCredential, err = applicationcredentials.Create(callCtx, identityClient, currentUser.ID, createOpts).Extract()
+		cancel()
+		if err == nil || !gophercloud.ResponseCodeIs(err, http.StatusConflict) || attempt == maxCreateAttempts {
+			break
+		}
+		slog.Warn("Application credential name conflict, retrying with a new name", "attempt", attempt)
+	}
+	var missingRoles *MissingRolesError
+	if err != nil && !errors.As(err, &missingRoles) {
+		// the cached token might have been revoked
+		c.cache.delete(key)
+	}
 
 	return applicationCredential, identityClient, err
 }
 
-func newGophercloudClients(ctx context.Context, auth map[string]string) (*gophercloud.ProviderClient, *gophercloud.ServiceClient, error) {
-	authOptions, err := AuthOptionsFromMap(auth)
+func (c Client) DeleteApplicationCredential(ctx context.Context, identityClient *gophercloud.ServiceClient, id string) error {
+	currentToken, ok := identityClient.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return errors.New("failed to get auth result of current token")
+	}
+	currentUser, err := currentToken.ExtractUser()
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 
-	providerClient, err := openstack.AuthenticatedClient(ctx, authOptions)
-	if err != nil {
-		return providerClient, nil, err
+	callCtx, cancel := c.callContext(ctx)
+	defer cancel()
+	return applicationcredentials.Delete(callCtx, identityClient, currentUser.ID, id).ExtractErr()
+}
+
+func (c Client) newGophercloudClients(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, key string) (*gophercloud.ProviderClient, *gophercloud.ServiceClient, error) {
+	providerClient := c.cache.get(key)
+	if providerClient == nil {
+		var err error
+		providerClient, err = c.newAuthenticatedClient(ctx, auth, scope)
+		if err != nil {
+			return providerClient, nil, err
+		}
+		c.cache.put(key, providerClient)
 	}
 
 	eo := gophercloud.EndpointOpts{
@@ -64,110 +157,40 @@ func newGophercloudClients(ctx context.Context, auth map[string]string) (*gopher
 	return providerClient, identityClient, nil
 }
 
-// AuthOptionsFromMap is a copy of openstack.AuthOptionsFromEnv, returning
-// gophercloud.AuthOptions for input map which items represent corresponding OS
-// environment variable names and values
-// https://github.com/gophercloud/gophercloud/blob/9e4535f6f0974f25793e62c03e2794097dfa1a43/openstack/auth_env.go#L36
-// ¯\_(ツ)_/¯
-func AuthOptionsFromMap(authMap map[string]string) (gophercloud.AuthOptions, error) {
-	authURL := authMap["OS_AUTH_URL"]
-	username := authMap["OS_USERNAME"]
-	userID := authMap["OS_USERID"]
-	password := authMap["OS_PASSWORD"]
-	passcode := authMap["OS_PASSCODE"]
-	tenantID := authMap["OS_TENANT_ID"]
-	tenantName := authMap["OS_TENANT_NAME"]
-	domainID := authMap["OS_DOMAIN_ID"]
-	domainName := authMap["OS_DOMAIN_NAME"]
-	applicationCredentialID := authMap["OS_APPLICATION_CREDENTIAL_ID"]
-	applicationCredentialName := authMap["OS_APPLICATION_CREDENTIAL_NAME"]
-	applicationCredentialSecret := authMap["OS_APPLICATION_CREDENTIAL_SECRET"]
-	systemScope := authMap["OS_SYSTEM_SCOPE"]
-
-	// If OS_PROJECT_ID is set, overwrite tenantID with the value.
-	if v := authMap["OS_PROJECT_ID"]; v != "" {
-		tenantID = v
-	}
-
-	// If OS_PROJECT_NAME is set, overwrite tenantName with the value.
-	if v := authMap["OS_PROJECT_NAME"]; v != "" {
-		tenantName = v
-	}
-
-	if authURL == "" {
-		err := gophercloud.ErrMissingEnvironmentVariable{
-			EnvironmentVariable: "OS_AUTH_URL",
-		}
-		return gophercloud.AuthOptions{}, err
-	}
-
-	if userID == "" && username == "" {
-		// Empty username and userID could be ignored, when applicationCredentialID and applicationCredentialSecret are set
-		if applicationCredentialID == "" && applicationCredentialSecret == "" {
-			err := gophercloud.ErrMissingAnyoneOfEnvironmentVariables{
-				EnvironmentVariables: []string{"OS_USERID", "OS_USERNAME"},
-			}
-			return gophercloud.AuthOptions{}, err
-		}
-	}
-
-	if password == "" && passcode == "" && applicationCredentialID == "" && applicationCredentialName == "" {
-		err := gophercloud.ErrMissingEnvironmentVariable{
-			// silently ignore TOTP passcode warning, since it is not a common auth method
-			EnvironmentVariable: "OS_PASSWORD",
-		}
-		return gophercloud.AuthOptions{}, err
-	}
-
-	if (applicationCredentialID != "" || applicationCredentialName != "") && applicationCredentialSecret == "" {
-		err := gophercloud.ErrMissingEnvironmentVariable{
-			EnvironmentVariable: "OS_APPLICATION_CREDENTIAL_SECRET",
-		}
-		return gophercloud.AuthOptions{}, err
-	}
-
-	if domainID == "" && domainName == "" && tenantID == "" && tenantName != "" {
-		err := gophercloud.ErrMissingEnvironmentVariable{
-			EnvironmentVariable: "OS_PROJECT_ID",
-		}
-		return gophercloud.AuthOptions{}, err
+func (c Client) newAuthenticatedClient(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope) (*gophercloud.ProviderClient, error) {
+	authOptions, err := AuthOptionsFromMap(auth)
+	if err != nil {
+		return nil, err
 	}
 
-	if applicationCredentialID == "" && applicationCredentialName != "" && applicationCredentialSecret != "" {
-		if userID == "" && username == "" {
-			return gophercloud.AuthOptions{}, gophercloud.ErrMissingAnyoneOfEnvironmentVariables{
-				EnvironmentVariables: []string{"OS_USERID", "OS_USERNAME"},
-			}
-		}
-		if username != "" && domainID == "" && domainName == "" {
-			return gophercloud.AuthOptions{}, gophercloud.ErrMissingAnyoneOfEnvironmentVariables{
-				EnvironmentVariables: []string{"OS_DOMAIN_ID", "OS_DOMAIN_NAME"},
-			}
-		}
+	callCtx, cancel := c.callContext(ctx)
+	providerClient, err := openstack.AuthenticatedClient(callCtx, authOptions)
+	cancel()
+	if err != nil {
+		return providerClient, err
 	}
 
-	var scope *gophercloud.AuthScope
-	if systemScope == "all" {
-		scope = &gophercloud.AuthScope{
-			System: true,
+	if scope != nil {
+		callCtx, cancel := c.callContext(ctx)
+		providerClient, err = rescope(callCtx, providerClient, authOptions.IdentityEndpoint, scope)
+		cancel()
+		if err != nil {
+			return providerClient, fmt.Errorf("failed to re-scope token, error: %w", err)
 		}
 	}
+	return providerClient, nil
+}
 
-	ao := gophercloud.AuthOptions{
-		IdentityEndpoint:            authURL,
-		UserID:                      userID,
-		Username:                    username,
-		Password:                    password,
-		Passcode:                    passcode,
-		TenantID:                    tenantID,
-		TenantName:                  tenantName,
-		DomainID:                    domainID,
-		DomainName:                  domainName,
-		ApplicationCredentialID:     applicationCredentialID,
-		ApplicationCredentialName:   applicationCredentialName,
-		ApplicationCredentialSecret: applicationCredentialSecret,
-		Scope:                       scope,
-	}
-
-	return ao, nil
+// rescope exchanges the token of providerClient for a new one with the scope
+func rescope(ctx context.Context, providerClient *gophercloud.ProviderClient, identityEndpoint string, scope *gophercloud.AuthScope) (*gophercloud.ProviderClient, error) {
+	rescoped, err := openstack.NewClient(identityEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	err = openstack.Authenticate(ctx, rescoped, gophercloud.AuthOptions{
+		IdentityEndpoint: identityEndpoint,
+		TokenID:          providerClient.Token(),
+		Scope:            scope,
+	})
+	return rescoped, err
 }
@@ -0,0 +1,307 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/openstacktest"
+)
+
+// conflictingCreateOpts yields the taken name on the first call and unique
+// names afterwards
+type conflictingCreateOpts struct {
+	taken string
+	calls *atomic.Int32
+	id    int
+}
+
+func (o conflictingCreateOpts) ToApplicationCredentialCreateMap() (map[string]any, error) {
+	name := o.taken
+	if call := o.calls.Add(1); call > 1 {
+		name = fmt.Sprintf("name-%d-%d", o.id, call)
+	}
+	return applicationcredentials.CreateOpts{Name: name}.ToApplicationCredentialCreateMap()
+}
+
+func TestCreateApplicationCredentialRetriesConflicts(t *testing.T) {
+	const taken = "secrets-store-csi-taken"
+	srv := openstacktest.NewServer(t)
+	srv.TakeName(taken)
+	auth := srv.Credentials()
+
+	const concurrency = 16
+	var wg sync.WaitGroup
+	ids := make([]string, concurrency)
+	errs := make([]error, concurrency)
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			createOpts := conflictingCreateOpts{taken: taken, calls: &atomic.Int32{}, id: i}
+			ac, _, err := Client{}.CreateApplicationCredential(context.TODO(), auth, nil, createOpts)
+			errs[i] = err
+			if ac != nil {
+				ids[i] = ac.ID
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i := range concurrency {
+		if errs[i] != nil {
+			t.Fatalf("CreateApplicationCredential failed: %v", errs[i])
+		}
+		if seen[ids[i]] {
+			t.Fatalf("duplicate application credential %s", ids[i])
+		}
+		seen[ids[i]] = true
+	}
+	if got := srv.Conflicts(); got != concurrency {
+		t.Errorf("got %d conflicts, want %d", got, concurrency)
+	}
+}
+
+func TestCreateApplicationCredentialGivesUpOnConflicts(t *testing.T) {
+	const taken = "secrets-store-csi-taken"
+	srv := openstacktest.NewServer(t)
+	srv.TakeName(taken)
+	auth := srv.Credentials()
+
+	createOpts := applicationcredentials.CreateOpts{Name: taken}
+	_, _, err := Client{}.CreateApplicationCredential(context.TODO(), auth, nil, createOpts)
+	if !gophercloud.ResponseCodeIs(err, http.StatusConflict) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if got := srv.Conflicts(); got != maxCreateAttempts {
+		t.Errorf("got %d attempts, want %d", got, maxCreateAttempts)
+	}
+}
+
+func TestCreateApplicationCredentialWithTrust(t *testing.T) {
+	srv := openstacktest.NewServer(t)
+	srv.Users = append(srv.Users, openstacktest.User{ID: "service-id", Name: "service", Password: "password", Domain: openstacktest.DefaultDomain})
+	auth := map[string]string{
+		"OS_AUTH_URL":     srv.AuthURL(),
+		"OS_USERNAME":     "service",
+		"OS_PASSWORD":     "password",
+		"OS_DOMAIN_ID":    "default",
+		"OS_PROJECT_NAME": "service",
+		"OS_TRUST_ID":     "trust-id",
+	}
+
+	_, _, err := Client{}.CreateApplicationCredential(context.TODO(), auth, nil, applicationcredentials.CreateOpts{Name: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"OS-TRUST:trust": map[string]any{"id": "trust-id"}}
+	if diff := cmp.Diff(want, srv.LastTokenRequest().Scope); diff != "" {
+		t.Errorf("token scope mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCreateApplicationCredentialRescoped(t *testing.T) {
+	srv := openstacktest.NewServer(t)
+	auth := srv.Credentials()
+	scope := &gophercloud.AuthScope{ProjectName: "other", DomainName: "Default"}
+
+	_, _, err := Client{}.CreateApplicationCredential(context.TODO(), auth, scope, applicationcredentials.CreateOpts{Name: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantScope := map[string]any{"project": map[string]any{"name": "other", "domain": map[string]any{"name": "Default"}}}
+	if diff := cmp.Diff(wantScope, srv.LastTokenRequest().Scope); diff != "" {
+		t.Errorf("token scope mismatch (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"token"}, srv.LastTokenRequest().Methods); diff != "" {
+		t.Errorf("re-scoping should authenticate with the token (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCreateApplicationCredentialCachesClients(t *testing.T) {
+	srv := openstacktest.NewServer(t)
+	auth := srv.Credentials()
+	scope := &gophercloud.AuthScope{ProjectID: openstacktest.OtherProject.ID}
+
+	tests := map[string]struct {
+		client Client
+		tokens int
+	}{
+		"without cache": {
+			client: Client{},
+			tokens: 6,
+		},
+		"with cache": {
+			client: NewClient(time.Minute),
+			// one token without scope, and two for the scoped one
+			tokens: 3,
+		},
+		"with cache disabled": {
+			client: NewClient(0),
+			tokens: 6,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv.ResetTokenRequests()
+			for i := range 2 {
+				createOpts := applicationcredentials.CreateOpts{Name: fmt.Sprintf("%s-%d", name, i)}
+				if _, _, err := tc.client.CreateApplicationCredential(context.TODO(), auth, nil, createOpts); err != nil {
+					t.Fatal(err)
+				}
+				createOpts.Name += "-scoped"
+				if _, _, err := tc.client.CreateApplicationCredential(context.TODO(), auth, scope, createOpts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := srv.TokenRequests(); got != tc.tokens {
+				t.Errorf("expected %d token requests, got %d", tc.tokens, got)
+			}
+		})
+	}
+}
+
+func TestCreateApplicationCredentialEvictsCacheOnError(t *testing.T) {
+	const taken = "taken"
+	srv := openstacktest.NewServer(t)
+	srv.TakeName(taken)
+	auth := srv.Credentials()
+	client := NewClient(time.Minute)
+
+	if _, _, err := client.CreateApplicationCredential(context.TODO(), auth, nil, applicationcredentials.CreateOpts{Name: taken}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, _, err := client.CreateApplicationCredential(context.TODO(), auth, nil, applicationcredentials.CreateOpts{Name: "name"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.TokenRequests(); got != 2 {
+		t.Errorf("expected a new token after the error, got %d token requests", got)
+	}
+}
+
+func TestCreateApplicationCredentialCallTimeout(t *testing.T) {
+	srv := openstacktest.NewServer(t)
+	auth := srv.Credentials()
+	client := NewClient(time.Minute, WithCallTimeout(100*time.Millisecond))
+
+	// a cached token, so the create call itself times out next
+	if _, _, err := client.CreateApplicationCredential(context.TODO(), auth, nil, applicationcredentials.CreateOpts{Name: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Delay(time.Minute)
+	start := time.Now()
+	_, _, err := client.CreateApplicationCredential(context.TODO(), auth, nil, applicationcredentials.CreateOpts{Name: "second"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("call should time out after 100ms, took %s", elapsed)
+	}
+
+	// and authentication of an evicted token
+	_, _, err = client.CreateApplicationCredential(context.TODO(), auth, nil, applicationcredentials.CreateOpts{Name: "third"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestCreateApplicationCredentialRoles(t *testing.T) {
+	tests := map[string]struct {
+		userRoles []openstacktest.Role
+		roles     []string
+		wantRoles []openstacktest.Role
+		wantErr   *MissingRolesError
+	}{
+		"all assigned roles": {
+			wantRoles: []openstacktest.Role{openstacktest.MemberRole, openstacktest.ReaderRole},
+		},
+		"by name": {
+			roles:     []string{"member"},
+			wantRoles: []openstacktest.Role{openstacktest.MemberRole},
+		},
+		"by ID": {
+			roles:     []string{openstacktest.ReaderRole.ID},
+			wantRoles: []openstacktest.Role{openstacktest.ReaderRole},
+		},
+		"unknown roles": {
+			roles: []string{"member", "admin", "load-balancer_member"},
+			wantErr: &MissingRolesError{
+				Roles:    []string{"admin", "load-balancer_member"},
+				Project:  tokens.Project{ID: openstacktest.DefaultProject.ID, Name: openstacktest.DefaultProject.Name, Domain: tokens.Domain{ID: "default", Name: "Default"}},
+				Assigned: []string{"member", "reader"},
+			},
+		},
+		"role not assigned to the user": {
+			userRoles: []openstacktest.Role{openstacktest.MemberRole},
+			roles:     []string{"reader"},
+			wantErr: &MissingRolesError{
+				Roles:    []string{"reader"},
+				Project:  tokens.Project{ID: openstacktest.DefaultProject.ID, Name: openstacktest.DefaultProject.Name, Domain: tokens.Domain{ID: "default", Name: "Default"}},
+				Assigned: []string{"member"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := openstacktest.NewServer(t)
+			srv.Users[0].Roles = tc.userRoles
+			createOpts := applicationcredentials.CreateOpts{Name: "name"}
+			for _, role := range tc.roles {
+				createOpts.Roles = append(createOpts.Roles, applicationcredentials.Role{Name: role})
+			}
+
+			_, _, err := Client{}.CreateApplicationCredential(context.TODO(), srv.Credentials(), nil, createOpts)
+			if tc.wantErr != nil {
+				var missingRoles *MissingRolesError
+				if !errors.As(err, &missingRoles) {
+					t.Fatalf("expected MissingRolesError, got %v", err)
+				}
+				if diff := cmp.Diff(tc.wantErr, missingRoles); diff != "" {
+					t.Errorf("error mismatch (-want, +got):\n%s", diff)
+				}
+				if acs := srv.ApplicationCredentials(); len(acs) != 0 {
+					t.Errorf("no application credential should be created, got %+v", acs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			acs := srv.ApplicationCredentials()
+			if len(acs) != 1 {
+				t.Fatalf("expected one application credential, got %+v", acs)
+			}
+			if diff := cmp.Diff(tc.wantRoles, acs[0].Roles); diff != "" {
+				t.Errorf("roles mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMissingRolesError(t *testing.T) {
+	err := &MissingRolesError{
+		Roles:    []string{"admin"},
+		Project:  tokens.Project{ID: "project-id", Name: "demo"},
+		Assigned: []string{"member", "reader"},
+	}
+	want := "roles admin are not assigned to the user on project demo (project-id), assigned roles are member, reader"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
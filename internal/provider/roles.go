@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+)
+
+// MissingRolesError reports requested roles not assigned to the user on the
+// project the credential would be created in
+type MissingRolesError struct {
+	// Roles are the missing names or IDs as requested
+	Roles   []string
+	Project tokens.Project
+	// Assigned are the names of roles the user holds on Project
+	Assigned []string
+}
+
+func (e *MissingRolesError) Error() string {
+	return fmt.Sprintf("roles %s are not assigned to the user on project %s (%s), assigned roles are %s",
+		strings.Join(e.Roles, ", "), e.Project.Name, e.Project.ID, strings.Join(e.Assigned, ", "))
+}
+
+// roleResolvingCreateOpts resolves the roles requested by name or ID to the
+// IDs of roles assigned to the user, as listed by its project scoped token.
+// Keystone only delegates roles the user holds on the project, but rejects
+// others with a bare 404 or 403 naming no role.
+type roleResolvingCreateOpts struct {
+	applicationcredentials.CreateOptsBuilder
+	assigned []tokens.Role
+	project  tokens.Project
+}
+
+func (o roleResolvingCreateOpts) ToApplicationCredentialCreateMap() (map[string]any, error) {
+	b, err := o.CreateOptsBuilder.ToApplicationCredentialCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	applicationCredential, ok := b["application_credential"].(map[string]any)
+	if !ok {
+		return nil, errors.New("application_credential should be an object")
+	}
+	requested, _ := applicationCredential["roles"].([]any)
+	if len(requested) == 0 {
+		return b, nil
+	}
+
+	var resolved []any
+	var missing []string
+	for _, r := range requested {
+		role, _ := r.(map[string]any)
+		id, _ := role["id"].(string)
+		name, _ := role["name"].(string)
+		// the server requests roles by name, which may also be an ID
+		i := slices.IndexFunc(o.assigned, func(assigned tokens.Role) bool {
+			if id != "" {
+				return id == assigned.ID
+			}
+			return name == assigned.Name || name == assigned.ID
+		})
+		if i < 0 {
+			missing = append(missing, cmp.Or(id, name))
+			continue
+		}
+		resolved = append(resolved, map[string]any{"id": o.assigned[i].ID})
+	}
+	if len(missing) > 0 {
+		assigned := make([]string, len(o.assigned))
+		for i, role := range o.assigned {
+			assigned[i] = role.Name
+		}
+		return nil, &MissingRolesError{Roles: missing, Project: o.project, Assigned: assigned}
+	}
+	applicationCredential["roles"] = resolved
+	return b, nil
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package render runs the Mount pipeline for SecretProviderClass and Secret
+// manifests outside of a cluster, to iterate on templates locally.
+package render
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// SecretProviderClass is the subset of the manifest used to build a
+// MountRequest
+type SecretProviderClass struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Provider   string            `json:"provider"`
+		Parameters map[string]string `json:"parameters"`
+	} `json:"spec"`
+}
+
+// ParseSecretProviderClass parses a SecretProviderClass manifest of
+// providerName, the --provider-name of the provider
+func ParseSecretProviderClass(data []byte, providerName string) (*SecretProviderClass, error) {
+	var spc SecretProviderClass
+	if err := yaml.Unmarshal(data, &spc); err != nil {
+		return nil, fmt.Errorf("failed to parse SecretProviderClass, error: %w", err)
+	}
+	if spc.Kind != "SecretProviderClass" {
+		return nil, fmt.Errorf("kind should be SecretProviderClass, got %q", spc.Kind)
+	}
+	if spc.Spec.Provider != providerName {
+		return nil, fmt.Errorf("spec.provider should be %s, got %q", providerName, spc.Spec.Provider)
+	}
+	return &spc, nil
+}
+
+// ParseSecret parses a Secret manifest, merging its data and stringData like
+// the API server does, or a plain YAML map such as OS_* variables
+func ParseSecret(data []byte) (map[string]string, error) {
+	var secret struct {
+		Kind       string            `json:"kind"`
+		Data       map[string]string `json:"data"`
+		StringData map[string]string `json:"stringData"`
+	}
+	if err := yaml.Unmarshal(data, &secret); err != nil || secret.Kind != "Secret" {
+		var plain map[string]string
+		if err := yaml.Unmarshal(data, &plain); err != nil {
+			return nil, fmt.Errorf("failed to parse secrets, should be a Secret manifest or a map of strings, error: %w", err)
+		}
+		return plain, nil
+	}
+
+	secrets := map[string]string{}
+	for k, v := range secret.Data {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode data.%s of Secret, error: %w", k, err)
+		}
+		secrets[k] = string(decoded)
+	}
+	for k, v := range secret.StringData {
+		secrets[k] = v
+	}
+	return secrets, nil
+}
+
+// Pod is the Pod the volume is mounted for
+type Pod struct {
+	Namespace      string
+	Name           string
+	UID            string
+	ServiceAccount string
+}
+
+// MountRequest returns the request the driver would send for the Pod
+func MountRequest(spc *SecretProviderClass, secrets map[string]string, pod Pod, targetPath string, permission os.FileMode) (*v1alpha1.MountRequest, error) {
+	attributes := map[string]string{}
+	for k, v := range spc.Spec.Parameters {
+		attributes[k] = v
+	}
+	namespace := pod.Namespace
+	if namespace == "" {
+		namespace = spc.Metadata.Namespace
+	}
+	attributes["csi.storage.k8s.io/pod.namespace"] = namespace
+	attributes["csi.storage.k8s.io/pod.name"] = pod.Name
+	attributes["csi.storage.k8s.io/pod.uid"] = pod.UID
+	attributes["csi.storage.k8s.io/serviceAccount.name"] = pod.ServiceAccount
+	attributes["secretProviderClass"] = spc.Metadata.Name
+
+	attributesJSON, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, err
+	}
+	secretsJSON, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+	permissionJSON, err := json.Marshal(permission)
+	if err != nil {
+		return nil, err
+	}
+	return &v1alpha1.MountRequest{
+		Attributes: string(attributesJSON),
+		Secrets:    string(secretsJSON),
+		TargetPath: targetPath,
+		Permission: string(permissionJSON),
+	}, nil
+}
+
+// Print writes the files and object versions of the response
+func Print(w io.Writer, response *v1alpha1.MountResponse, permission os.FileMode) error {
+	for _, file := range response.GetFiles() {
+		mode := permission
+		if file.GetMode() != 0 {
+			mode = os.FileMode(file.GetMode())
+		}
+		if _, err := fmt.Fprintf(w, "==> %s (%#o) <==\n%s\n", file.GetPath(), mode, file.GetContents()); err != nil {
+			return err
+		}
+	}
+	for _, objectVersion := range response.GetObjectVersion() {
+		if _, err := fmt.Fprintf(w, "object %s version %s\n", objectVersion.GetId(), objectVersion.GetVersion()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/provider"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/server"
+)
+
+const testSecretProviderClass = `
+apiVersion: secrets-store.csi.x-k8s.io/v1
+kind: SecretProviderClass
+metadata:
+  name: my-openstack
+  namespace: team-a
+spec:
+  provider: openstack
+  parameters:
+    applicationCredentials: |
+      - files:
+        - fileName: clouds.yaml
+        - fileName: openrc
+          format: openrc
+          mode: 0600
+        roles: [member]
+`
+
+func TestParseSecretProviderClass(t *testing.T) {
+	tests := map[string]struct {
+		manifest     string
+		providerName string
+		wantErr      string
+	}{
+		"valid": {
+			manifest: testSecretProviderClass,
+		},
+		"custom provider name": {
+			manifest:     strings.Replace(testSecretProviderClass, "provider: openstack", "provider: openstack-staging", 1),
+			providerName: "openstack-staging",
+		},
+		"default provider name with custom provider name": {
+			manifest:     testSecretProviderClass,
+			providerName: "openstack-staging",
+			wantErr:      `spec.provider should be openstack-staging, got "openstack"`,
+		},
+		"other kind": {
+			manifest: "kind: Secret\n",
+			wantErr:  `kind should be SecretProviderClass, got "Secret"`,
+		},
+		"other provider": {
+			manifest: "kind: SecretProviderClass\nspec:\n  provider: vault\n",
+			wantErr:  `spec.provider should be openstack, got "vault"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			providerName := tc.providerName
+			if providerName == "" {
+				providerName = "openstack"
+			}
+			spc, err := ParseSecretProviderClass([]byte(tc.manifest), providerName)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spc.Metadata.Name != "my-openstack" || spc.Spec.Parameters["applicationCredentials"] == "" {
+				t.Errorf("unexpected SecretProviderClass %+v", spc)
+			}
+		})
+	}
+}
+
+func TestParseSecret(t *testing.T) {
+	tests := map[string]struct {
+		manifest string
+		want     map[string]string
+	}{
+		"Secret": {
+			manifest: `
+apiVersion: v1
+kind: Secret
+data:
+  OS_AUTH_URL: aHR0cDovL2xvY2FsaG9zdDo1MDAwL3YzLw==
+  OS_REGION_NAME: UmVnaW9uT25l
+stringData:
+  OS_REGION_NAME: RegionTwo
+`,
+			want: map[string]string{"OS_AUTH_URL": "http://localhost:5000/v3/", "OS_REGION_NAME": "RegionTwo"},
+		},
+		"plain map": {
+			manifest: "OS_AUTH_URL: http://localhost:5000/v3/\n",
+			want:     map[string]string{"OS_AUTH_URL": "http://localhost:5000/v3/"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseSecret([]byte(tc.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("secrets mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRenderDryRun(t *testing.T) {
+	spc, err := ParseSecretProviderClass([]byte(testSecretProviderClass), "openstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := MountRequest(spc, map[string]string{"OS_AUTH_URL": "http://localhost:5000/v3/"}, Pod{Name: "app", ServiceAccount: "app"}, "/dev/null", 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nameTemplate, err := server.NewNameTemplate("{{ .Pod.Namespace }}-{{ .Pod.Name }}-{{ .SecretProviderClass }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := server.NewServer(provider.DryRunClient{}, server.WithNameTemplate(nameTemplate)).Mount(context.TODO(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := server.ParseApplicationCredentials(spc.Spec.Parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Print(&out, response, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"==> clouds.yaml (0644) <==\n",
+		"==> openrc (0600) <==\n",
+		`application_credential_id: "dry-run-team-a-app-my-openstack"`,
+		"export OS_APPLICATION_CREDENTIAL_SECRET='" + provider.DryRunSecret + "'",
+		"object dry-run-team-a-app-my-openstack version " + objects[0].Fingerprint() + "-",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output should contain %q, got:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "<no value>") {
+		t.Errorf("output should not contain missing values:\n%s", out.String())
+	}
+}
@@ -6,87 +6,469 @@ package server
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"math/rand"
-	"strconv"
+	"math/big"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
 	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gophercloud/gophercloud/v2"
 
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
-)
-
-const (
-	DefaultTemplate string = `clouds:
-  secrets-store-csi:
-    auth:
-      application_credential_id: "{{ .AuthInfo.ApplicationCredentialID }}"
-      application_credential_secret: "{{ .AuthInfo.ApplicationCredentialSecret }}"
-      auth_url: "{{ .AuthInfo.AuthURL }}"
-    auth_type: "{{ .AuthType }}"
-`
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
 
 type ApplicationCredentialObject struct {
+	// ObjectFile fields describe the single file rendered for the credential,
+	// unless Files are used
+	ObjectFile `json:",inline" yaml:",inline"`
+	// Files are rendered from the same credential, mutually exclusive with
+	// ObjectFile fields
+	Files []ObjectFile `json:"files,omitempty" yaml:"files,omitempty"`
+	// Roles are names of roles delegated to the credential, all roles of the
+	// current token are delegated if empty
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// ExpiresIn is the lifetime of the credential, the server default if not
+	// set
+	ExpiresIn *Duration `json:"expiresIn,omitempty" yaml:"expiresIn,omitempty"`
+	// ProjectID, or ProjectName with DomainID or DomainName, re-scope the
+	// authenticated token to another project the user is a member of before
+	// creating the credential
+	ProjectID   string `json:"projectID,omitempty" yaml:"projectID,omitempty"`
+	ProjectName string `json:"projectName,omitempty" yaml:"projectName,omitempty"`
+	DomainID    string `json:"domainID,omitempty" yaml:"domainID,omitempty"`
+	DomainName  string `json:"domainName,omitempty" yaml:"domainName,omitempty"`
+	// Cloud selects a cloud of clouds.yaml provided in the Secret
+	Cloud string `json:"cloud,omitempty" yaml:"cloud,omitempty"`
+	// Region overrides the region of the credentials
+	Region string `json:"region,omitempty" yaml:"region,omitempty"`
+	// AccessRules restrict the API calls the credential may make, any calls
+	// allowed by Roles are permitted if empty
+	AccessRules []AccessRule `json:"accessRules,omitempty" yaml:"accessRules,omitempty"`
+}
+
+// AccessRule permits calls with the method to the path of the service, see
+// https://docs.openstack.org/keystone/latest/user/application_credentials.html#access-rules
+type AccessRule struct {
+	// Service is the service type of the catalog, e.g. object-store
+	Service string `json:"service" yaml:"service"`
+	// Method is the HTTP method, e.g. GET
+	Method string `json:"method" yaml:"method"`
+	// Path is the API path, and may contain * matching a single segment and
+	// ** matching any number of them, e.g. /v1/*/container/**
+	Path string `json:"path" yaml:"path"`
+}
+
+// accessRuleMethods are the HTTP methods Keystone accepts in access rules
+var accessRuleMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// serviceTypeRegexp matches service types of the service catalog
+var serviceTypeRegexp = regexp.MustCompile(`^[a-z0-9][-_a-z0-9]*$`)
+
+func (r AccessRule) Validate() error {
+	if !serviceTypeRegexp.MatchString(r.Service) {
+		return fmt.Errorf("service %q should be a service type, e.g. object-store", r.Service)
+	}
+	if !slices.Contains(accessRuleMethods, r.Method) {
+		return fmt.Errorf("method %q should be one of %s", r.Method, strings.Join(accessRuleMethods, ", "))
+	}
+	if !strings.HasPrefix(r.Path, "/") || strings.ContainsFunc(r.Path, unicode.IsSpace) {
+		return fmt.Errorf("path %q should be an absolute API path without spaces", r.Path)
+	}
+	return nil
+}
+
+const DefaultExpiresIn = time.Hour
+
+// Duration is time.Duration represented as string, e.g. 1h30m
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration should be a string, e.g. 1h30m")
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Scope returns the scope to re-scope the token to, nil if the token scope
+// should be used as is
+func (o ApplicationCredentialObject) Scope() *gophercloud.AuthScope {
+	if o.ProjectID == "" && o.ProjectName == "" {
+		return nil
+	}
+	return &gophercloud.AuthScope{
+		ProjectID:   o.ProjectID,
+		ProjectName: o.ProjectName,
+		DomainID:    o.DomainID,
+		DomainName:  o.DomainName,
+	}
+}
+
+// GetExpiresIn returns ExpiresIn or DefaultExpiresIn
+func (o ApplicationCredentialObject) GetExpiresIn() time.Duration {
+	if o.ExpiresIn == nil {
+		return DefaultExpiresIn
+	}
+	return o.ExpiresIn.Duration
+}
+
+type ObjectFile struct {
 	FileName string  `json:"fileName" yaml:"fileName"`
 	Template *string `json:"template,omitempty" yaml:"template,omitempty"`
-	// embed ApplicationCredential
+	// Format is one of built-in Formats, mutually exclusive with Template
+	Format *string `json:"format,omitempty" yaml:"format,omitempty"`
+	// Mode is the file permission bits, the driver default is used if not set
+	Mode *int32 `json:"mode,omitempty" yaml:"mode,omitempty"`
+}
+
+func (o ApplicationCredentialObject) Validate() error {
+	if len(o.Files) > 0 && o.ObjectFile != (ObjectFile{}) {
+		return fmt.Errorf("files and fileName, template, format or mode are mutually exclusive")
+	}
+	if o.GetExpiresIn() <= 0 {
+		return fmt.Errorf("expiresIn should be positive")
+	}
+	for _, role := range o.Roles {
+		if role == "" {
+			return fmt.Errorf("roles should not contain empty names")
+		}
+	}
+	switch {
+	case o.ProjectID != "" && o.ProjectName != "":
+		return fmt.Errorf("projectID and projectName are mutually exclusive")
+	case o.ProjectID != "" && (o.DomainID != "" || o.DomainName != ""):
+		return fmt.Errorf("domainID and domainName should only be used with projectName")
+	case o.ProjectName != "" && o.DomainID == "" && o.DomainName == "":
+		return fmt.Errorf("projectName requires domainID or domainName")
+	case o.ProjectName == "" && (o.DomainID != "" || o.DomainName != ""):
+		// application credentials are always project scoped
+		return fmt.Errorf("domainID and domainName require projectName")
+	case o.DomainID != "" && o.DomainName != "":
+		return fmt.Errorf("domainID and domainName are mutually exclusive")
+	}
+	for i, rule := range o.AccessRules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("invalid accessRules[%d], error: %w", i, err)
+		}
+	}
+
+	if len(o.Files) > MaxObjectFiles {
+		return fmt.Errorf("files should not have more than %d entries", MaxObjectFiles)
+	}
+	fileNames := map[string]bool{}
+	for _, f := range o.OutputFiles() {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+		if fileNames[f.FileName] {
+			return fmt.Errorf("duplicate fileName %q", f.FileName)
+		}
+		fileNames[f.FileName] = true
+	}
+	return nil
+}
+
+// Fingerprint identifies the credential the object requests. It changes with
+// every field affecting the credential, e.g. Roles or AccessRules, but not
+// with the files rendered from it.
+func (o ApplicationCredentialObject) Fingerprint() string {
+	data, err := json.Marshal(struct {
+		Roles       []string
+		ExpiresIn   time.Duration
+		Scope       *gophercloud.AuthScope
+		Cloud       string
+		Region      string
+		AccessRules []AccessRule
+	}{o.Roles, o.GetExpiresIn(), o.Scope(), o.Cloud, o.Region, o.AccessRules})
+	if err != nil {
+		// all fields are plain data
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// OutputFiles returns the files to render for the credential
+func (o ApplicationCredentialObject) OutputFiles() []ObjectFile {
+	if len(o.Files) > 0 {
+		return o.Files
+	}
+	return []ObjectFile{o.ObjectFile}
+}
+
+func (f ObjectFile) Validate() error {
+	if f.FileName == "" {
+		return fmt.Errorf("fileName should not be empty")
+	}
+	// files are written relative to the volume, so they must stay within it
+	if clean := path.Clean(f.FileName); path.IsAbs(f.FileName) || clean != f.FileName || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("fileName %q should be a relative path within the volume", f.FileName)
+	}
+	if f.Template != nil && f.Format != nil {
+		return fmt.Errorf("template and format are mutually exclusive")
+	}
+	if f.Template != nil && len(*f.Template) > MaxTemplateSize {
+		return fmt.Errorf("template of %q should not exceed %d bytes", f.FileName, MaxTemplateSize)
+	}
+	if f.Format != nil {
+		if _, ok := Formats[*f.Format]; !ok {
+			return fmt.Errorf("unknown format %q, should be one of %s", *f.Format, strings.Join(FormatNames(), ", "))
+		}
+	}
+	if f.Mode != nil && (*f.Mode < 0 || *f.Mode > 0o777) {
+		return fmt.Errorf("mode %#o of %q should be between 0 and 0777", *f.Mode, f.FileName)
+	}
+	// parse the template, so syntax errors and unknown functions are
+	// reported before any credential gets created. Executing it depends on
+	// the credential and its catalog, so it is only done at Mount.
+	if _, err := f.parseTemplate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+const (
+	DefaultNameTemplate string = "secrets-store-csi-{{ .Suffix }}"
+	// maximum length of application credential name accepted by Keystone
+	maxNameLength = 255
+	// suffixLength keeps random suffixes unique without a timestamp
+	suffixLength = 16
+)
+
+// NameData is the data passed to the template generating application
+// credential names
+type NameData struct {
+	Pod                 Pod
+	SecretProviderClass string
+	// Timestamp is the current Unix time in nanoseconds, not used by default
+	// as names are visible to anyone listing the user's credentials
+	Timestamp int64
+	// Suffix is a random string, to keep names unique
+	Suffix string
+}
+
+// NewNameTemplate parses the template generating application credential names
+func NewNameTemplate(tmpl string) (*template.Template, error) {
+	t, err := template.New("name").Funcs(templateFuncs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	// make sure the template is executable
+	if _, err := executeNameTemplate(t, MountContext{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func executeNameTemplate(t *template.Template, mountContext MountContext) (string, error) {
+	data := NameData{
+		Pod:                 mountContext.Pod,
+		SecretProviderClass: mountContext.SecretProviderClass,
+		Timestamp:           time.Now().UnixNano(),
+		Suffix:              randomSuffix(suffixLength),
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("application credential name should not be empty")
+	}
+	if len(name) > maxNameLength {
+		// shorten the text before the suffix, so names stay unique and
+		// retries on conflicts get a new one
+		if i := strings.LastIndex(name, data.Suffix); i >= 0 && len(name)-i <= maxNameLength {
+			name = truncateName(name[:i], maxNameLength-(len(name)-i)) + name[i:]
+		} else {
+			name = truncateName(name, maxNameLength)
+		}
+	}
+	return name, nil
 }
 
-func (o ApplicationCredentialObject) ToApplicationCredentialCreateMap() (map[string]any, error) {
-	// Should be processing parameters from embeded ApplicationCredential
-	d := time.Hour * 1
-	expiresAt := time.Now().Add(d).Truncate(time.Millisecond).UTC()
-	description := "Created with love by secrets-store-csi-driver-provider-openstack"
+// truncateName cuts name to at most n bytes at a rune boundary, as pod and
+// SecretProviderClass names may contain multi-byte characters
+func truncateName(name string, n int) string {
+	if len(name) <= n {
+		return name
+	}
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return name[:n]
+}
+
+// description describes the credential with the Pod it was issued for as
+// space separated key=value pairs, omitting unknown values
+func description(mountContext MountContext) string {
+	d := "Created by secrets-store-csi-driver-provider-openstack"
+	pairs := []struct{ key, value string }{
+		{"namespace", mountContext.Pod.Namespace},
+		{"pod", mountContext.Pod.Name},
+		{"podUID", mountContext.Pod.UID},
+		{"serviceAccount", mountContext.Pod.ServiceAccountName},
+		{"secretProviderClass", mountContext.SecretProviderClass},
+	}
+	for _, pair := range pairs {
+		if pair.value != "" {
+			d += fmt.Sprintf(" %s=%s", pair.key, pair.value)
+		}
+	}
+	return d
+}
+
+// applicationCredentialCreateOpts builds CreateOpts for the object in the
+// context of a Mount. Every call generates a new name.
+type applicationCredentialCreateOpts struct {
+	object       *ApplicationCredentialObject
+	mountContext MountContext
+	nameTemplate *template.Template
+}
+
+func (o applicationCredentialCreateOpts) ToApplicationCredentialCreateMap() (map[string]any, error) {
+	name, err := executeNameTemplate(o.nameTemplate, o.mountContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate application credential name, error: %w", err)
+	}
+
+	expiresAt := time.Now().Add(o.object.GetExpiresIn()).Truncate(time.Millisecond).UTC()
 	createOpts := applicationcredentials.CreateOpts{
-		Name:        "secrets-store-csi-" + randomSuffix(5),
-		Description: description,
+		Name:        name,
+		Description: description(o.mountContext),
 		ExpiresAt:   &expiresAt,
 	}
+	for _, role := range o.object.Roles {
+		createOpts.Roles = append(createOpts.Roles, applicationcredentials.Role{Name: role})
+	}
+	for _, rule := range o.object.AccessRules {
+		createOpts.AccessRules = append(createOpts.AccessRules, applicationcredentials.AccessRule{
+			Service: rule.Service,
+			Method:  rule.Method,
+			Path:    rule.Path,
+		})
+	}
 
 	return createOpts.ToApplicationCredentialCreateMap()
 }
 
+// randomSuffix returns a string of random lowercase letters and digits
+// generated with crypto/rand, so it is neither predictable nor colliding for
+// concurrent calls
 func randomSuffix(length int) string {
 	c := "abcdefghijklmnopqrstuvwxyz0123456789"
 	b := make([]byte, length)
-	ts := time.Now().UnixNano()
-	r := rand.New(rand.NewSource(ts))
+	charsetSize := big.NewInt(int64(len(c)))
 	for i := range b {
-		b[i] = c[r.Intn(len(c))]
+		n, err := rand.Int(rand.Reader, charsetSize)
+		if err != nil {
+			// crypto/rand.Reader never fails on supported platforms
+			panic(err)
+		}
+		b[i] = c[n.Int64()]
 	}
-	return fmt.Sprintf("%s-%s", strconv.FormatInt(ts, 10), string(b))
+	return string(b)
 }
 
-func (o ApplicationCredentialObject) Render(applicationCredential *applicationcredentials.ApplicationCredential, serviceClient *gophercloud.ServiceClient) ([]byte, error) {
-	cloudsConfig := newCloudConfig(applicationCredential, serviceClient)
-	return o.executeTemplate(cloudsConfig)
+// Render renders the files of the object for the credential, within the
+// budget shared by all objects of a Mount
+func (o ApplicationCredentialObject) Render(applicationCredential *applicationcredentials.ApplicationCredential, serviceClient *gophercloud.ServiceClient, mountContext MountContext, budget *templateBudget) ([]*v1alpha1.File, error) {
+	cloudsConfig := newCloudConfig(applicationCredential, serviceClient, mountContext)
+
+	var files []*v1alpha1.File
+	for _, f := range o.OutputFiles() {
+		contents, err := f.executeTemplate(cloudsConfig, budget)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %q, error: %w", f.FileName, err)
+		}
+		file := &v1alpha1.File{
+			Path:     f.FileName,
+			Contents: contents,
+		}
+		if f.Mode != nil {
+			file.Mode = *f.Mode
+		}
+		files = append(files, file)
+	}
+	return files, nil
 }
 
-func (o ApplicationCredentialObject) executeTemplate(cloudConfig *Cloud) ([]byte, error) {
+// parseTemplate parses the template of the file, naming it after the file so
+// errors refer to it as e.g. `template: clouds.yaml:3:14: ...`, and
+// instruments it for a bounded execution
+func (f ObjectFile) parseTemplate() (*template.Template, error) {
 	tmpl := DefaultTemplate
-	if o.Template != nil {
-		tmpl = *o.Template
+	switch {
+	case f.Template != nil:
+		tmpl = *f.Template
+	case f.Format != nil:
+		format, ok := Formats[*f.Format]
+		if !ok {
+			return nil, fmt.Errorf("unknown format %q", *f.Format)
+		}
+		tmpl = format
 	}
 
-	t, err := template.New("template").Parse(tmpl)
+	t, err := template.New(f.FileName).Funcs(templateFuncs).Option("missingkey=error").Parse(tmpl)
 	if err != nil {
-		return []byte{}, err
+		return nil, err
 	}
+	if err := instrument(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
 
-	var buf bytes.Buffer
-	err = t.Execute(&buf, cloudConfig)
+func (f ObjectFile) executeTemplate(cloudConfig *Cloud, budget *templateBudget) ([]byte, error) {
+	t, err := f.parseTemplate()
 	if err != nil {
 		return []byte{}, err
 	}
 
-	return buf.Bytes(), nil
+	w := &limitedWriter{limit: MaxFileSize}
+	if err := budget.execute(t, w, cloudConfig); err != nil {
+		return []byte{}, err
+	}
+
+	return w.buf.Bytes(), nil
 }
 
+// Cloud is the data passed to templates. Its layout loosely follows a single
+// clouds.yaml entry, extended with details of the issued application
+// credential and of the Pod the volume is mounted for.
 type Cloud struct {
-	AuthInfo AuthInfo
-	AuthType AuthType
+	AuthInfo   AuthInfo
+	AuthType   AuthType
+	RegionName string
+	Interface  string
+	// ExpiresAt is the zero time.Time when the credential never expires
+	ExpiresAt time.Time
+	// Roles are the roles delegated to the application credential
+	Roles   []Role
+	Catalog []CatalogEntry
+	Pod     Pod
 }
 
 type AuthType string
@@ -100,16 +482,123 @@ type AuthInfo struct {
 	ApplicationCredentialID     string
 	ApplicationCredentialSecret string
 	ApplicationCredentialName   string
+	ProjectID                   string
+	ProjectName                 string
+	ProjectDomainID             string
+	ProjectDomainName           string
+	UserID                      string
+	Username                    string
+	UserDomainID                string
+	UserDomainName              string
+}
+
+type Role struct {
+	ID       string
+	Name     string
+	DomainID string
+}
+
+type CatalogEntry struct {
+	ID        string
+	Name      string
+	Type      string
+	Endpoints []Endpoint
+}
+
+type Endpoint struct {
+	ID        string
+	Region    string
+	RegionID  string
+	Interface string
+	URL       string
+}
+
+// Pod describes the workload the volume is mounted for, as reported by the
+// driver via csi.storage.k8s.io/* attributes
+type Pod struct {
+	Namespace          string
+	Name               string
+	UID                string
+	ServiceAccountName string
+}
+
+// MountContext carries the request level details shared by all objects of a
+// single Mount
+type MountContext struct {
+	Pod                 Pod
+	SecretProviderClass string
+	RegionName          string
+	Interface           string
+}
+
+func newPod(attributes map[string]string) Pod {
+	return Pod{
+		Namespace:          attributes["csi.storage.k8s.io/pod.namespace"],
+		Name:               attributes["csi.storage.k8s.io/pod.name"],
+		UID:                attributes["csi.storage.k8s.io/pod.uid"],
+		ServiceAccountName: attributes["csi.storage.k8s.io/serviceAccount.name"],
+	}
 }
 
-func newCloudConfig(applicationCredential *applicationcredentials.ApplicationCredential, identityClient *gophercloud.ServiceClient) *Cloud {
-	return &Cloud{
+func newMountContext(attributes, secrets map[string]string) MountContext {
+	return MountContext{
+		Pod:                 newPod(attributes),
+		SecretProviderClass: attributes["secretProviderClass"],
+		RegionName:          secrets["OS_REGION_NAME"],
+		Interface:           secrets["OS_INTERFACE"],
+	}
+}
+
+func newCloudConfig(applicationCredential *applicationcredentials.ApplicationCredential, identityClient *gophercloud.ServiceClient, mountContext MountContext) *Cloud {
+	cloud := &Cloud{
 		AuthType: AuthV3ApplicationCredential,
 		AuthInfo: AuthInfo{
 			ApplicationCredentialID:     applicationCredential.ID,
 			ApplicationCredentialSecret: applicationCredential.Secret,
 			ApplicationCredentialName:   applicationCredential.Name,
 			AuthURL:                     identityClient.ResourceBaseURL(),
+			ProjectID:                   applicationCredential.ProjectID,
 		},
+		RegionName: mountContext.RegionName,
+		Interface:  mountContext.Interface,
+		ExpiresAt:  applicationCredential.ExpiresAt,
+		Pod:        mountContext.Pod,
+	}
+	for _, role := range applicationCredential.Roles {
+		cloud.Roles = append(cloud.Roles, Role{ID: role.ID, Name: role.Name, DomainID: role.DomainID})
 	}
+
+	// the rest is only known from the token used to create the credential
+	if identityClient.ProviderClient == nil {
+		return cloud
+	}
+	token, ok := identityClient.ProviderClient.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return cloud
+	}
+	if user, err := token.ExtractUser(); err == nil {
+		cloud.AuthInfo.UserID = user.ID
+		cloud.AuthInfo.Username = user.Name
+		cloud.AuthInfo.UserDomainID = user.Domain.ID
+		cloud.AuthInfo.UserDomainName = user.Domain.Name
+	}
+	if project, err := token.ExtractProject(); err == nil && project != nil {
+		if cloud.AuthInfo.ProjectID == "" {
+			cloud.AuthInfo.ProjectID = project.ID
+		}
+		cloud.AuthInfo.ProjectName = project.Name
+		cloud.AuthInfo.ProjectDomainID = project.Domain.ID
+		cloud.AuthInfo.ProjectDomainName = project.Domain.Name
+	}
+	if catalog, err := token.ExtractServiceCatalog(); err == nil {
+		for _, entry := range catalog.Entries {
+			catalogEntry := CatalogEntry{ID: entry.ID, Name: entry.Name, Type: entry.Type}
+			for _, endpoint := range entry.Endpoints {
+				catalogEntry.Endpoints = append(catalogEntry.Endpoints, Endpoint(endpoint))
+			}
+			cloud.Catalog = append(cloud.Catalog, catalogEntry)
+		}
+	}
+
+	return cloud
 }
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/provider"
+)
+
+// CloudsYAMLKey is the Secret key holding clouds.yaml with named clouds
+const CloudsYAMLKey = "clouds.yaml"
+
+// credentials hold either OS_* variables, or named clouds of clouds.yaml
+type credentials struct {
+	auth   map[string]string
+	clouds map[string]map[string]string
+	// defaultCloud is OS_CLOUD, or the only cloud of clouds.yaml
+	defaultCloud string
+}
+
+func parseCredentials(secrets map[string]string) (*credentials, error) {
+	cloudsYAML, ok := secrets[CloudsYAMLKey]
+	if !ok {
+		return &credentials{auth: secrets}, nil
+	}
+
+	clouds, err := provider.ParseCloudsYAML([]byte(cloudsYAML))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s, error: %w", CloudsYAMLKey, err)
+	}
+	c := &credentials{clouds: clouds, defaultCloud: secrets["OS_CLOUD"]}
+	if c.defaultCloud == "" && len(clouds) == 1 {
+		for name := range clouds {
+			c.defaultCloud = name
+		}
+	}
+	return c, nil
+}
+
+// forObject returns credentials of the cloud, in the region if set
+func (c *credentials) forObject(cloud, region string) (map[string]string, error) {
+	auth := c.auth
+	if c.clouds != nil {
+		if cloud == "" {
+			cloud = c.defaultCloud
+		}
+		if cloud == "" {
+			return nil, fmt.Errorf("cloud should be set, %s defines %s", CloudsYAMLKey, strings.Join(slices.Sorted(maps.Keys(c.clouds)), ", "))
+		}
+		var ok bool
+		auth, ok = c.clouds[cloud]
+		if !ok {
+			return nil, fmt.Errorf("cloud %q not found in %s", cloud, CloudsYAMLKey)
+		}
+	} else if cloud != "" {
+		return nil, fmt.Errorf("cloud %q requires %s in the Secret", cloud, CloudsYAMLKey)
+	}
+
+	if region != "" {
+		auth = maps.Clone(auth)
+		auth["OS_REGION_NAME"] = region
+	}
+	return auth, nil
+}
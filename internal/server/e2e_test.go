@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/openstacktest"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/provider"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// newProviderConn serves the provider over a unix socket the way the driver
+// talks to it, and returns a client connected to it
+func newProviderConn(t *testing.T, s *CSIDriverProviderServer) v1alpha1.CSIDriverProviderClient {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "openstack.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcSrv := grpc.NewServer()
+	v1alpha1.RegisterCSIDriverProviderServer(grpcSrv, s)
+	go func() { _ = grpcSrv.Serve(listener) }()
+	t.Cleanup(grpcSrv.Stop)
+
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return v1alpha1.NewCSIDriverProviderClient(conn)
+}
+
+func TestMountEndToEnd(t *testing.T) {
+	srv := openstacktest.NewServer(t)
+	client := newProviderConn(t, NewServer(provider.NewClient(time.Minute)))
+
+	attributes, _ := json.Marshal(map[string]string{
+		"applicationCredentials": `
+- files:
+  - fileName: clouds.yaml
+  - fileName: openrc
+    format: openrc
+  roles: [member]
+  expiresIn: 2h
+  accessRules:
+  - service: object-store
+    method: GET
+    path: /v1/*/backups/**
+- fileName: other.yaml
+  projectName: other
+  domainName: Default
+`,
+		"csi.storage.k8s.io/pod.namespace":       "team-a",
+		"csi.storage.k8s.io/pod.name":            "app",
+		"csi.storage.k8s.io/serviceAccount.name": "app",
+		"secretProviderClass":                    "my-openstack",
+	})
+	secrets, _ := json.Marshal(srv.Credentials())
+
+	before := time.Now()
+	response, err := client.Mount(context.TODO(), &v1alpha1.MountRequest{
+		Attributes: string(attributes),
+		Secrets:    string(secrets),
+		TargetPath: "/openstack-auth",
+		Permission: "420",
+	})
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+
+	acs := srv.ApplicationCredentials()
+	if len(acs) != 2 {
+		t.Fatalf("expected 2 application credentials, got %+v", acs)
+	}
+	byProject := map[string]openstacktest.ApplicationCredential{}
+	for _, ac := range acs {
+		byProject[ac.ProjectID] = ac
+	}
+	ac, other := byProject[openstacktest.DefaultProject.ID], byProject[openstacktest.OtherProject.ID]
+	if diff := cmp.Diff([]openstacktest.Role{openstacktest.MemberRole}, ac.Roles); diff != "" {
+		t.Errorf("roles mismatch (-want, +got):\n%s", diff)
+	}
+	wantRules := []openstacktest.AccessRule{{Service: "object-store", Method: "GET", Path: "/v1/*/backups/**"}}
+	if diff := cmp.Diff(wantRules, ac.AccessRules, cmpopts.IgnoreFields(openstacktest.AccessRule{}, "ID")); diff != "" {
+		t.Errorf("access rules mismatch (-want, +got):\n%s", diff)
+	}
+	if !strings.Contains(ac.Description, "namespace=team-a pod=app") {
+		t.Errorf("unexpected description %q", ac.Description)
+	}
+	expiresAt, err := time.Parse("2006-01-02T15:04:05.999999", ac.ExpiresAt)
+	if err != nil || expiresAt.Before(before.Add(2*time.Hour-time.Second)) || expiresAt.After(time.Now().Add(2*time.Hour)) {
+		t.Errorf("unexpected expiration %q, error: %v", ac.ExpiresAt, err)
+	}
+	if other.ID == "" {
+		t.Errorf("expected application credential in %s, got %+v", openstacktest.OtherProject.Name, acs)
+	}
+
+	var parameters map[string]string
+	_ = json.Unmarshal(attributes, &parameters)
+	objects, err := ParseApplicationCredentials(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherExpiresAt, err := time.Parse("2006-01-02T15:04:05.999999", other.ExpiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVersions := []*v1alpha1.ObjectVersion{
+		{Id: ac.ID, Version: newCredentialVersion(objects[0], srv.Credentials(), expiresAt).String()},
+		{Id: other.ID, Version: newCredentialVersion(objects[1], srv.Credentials(), otherExpiresAt).String()},
+	}
+	if diff := cmp.Diff(wantVersions, response.GetObjectVersion(), protocmp.Transform()); diff != "" {
+		t.Errorf("object versions mismatch (-want, +got):\n%s", diff)
+	}
+
+	var paths []string
+	for _, file := range response.GetFiles() {
+		paths = append(paths, file.GetPath())
+	}
+	if diff := cmp.Diff([]string{"clouds.yaml", "openrc", "other.yaml"}, paths); diff != "" {
+		t.Errorf("files mismatch (-want, +got):\n%s", diff)
+	}
+
+	// the rendered clouds.yaml holds a working credential
+	clouds, err := provider.ParseCloudsYAML(response.GetFiles()[0].GetContents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	authOptions, err := provider.AuthOptionsFromMap(clouds["secrets-store-csi"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authOptions.ApplicationCredentialID != ac.ID || authOptions.IdentityEndpoint != srv.AuthURL() {
+		t.Errorf("unexpected credentials %+v", authOptions)
+	}
+	if _, err := openstack.AuthenticatedClient(context.TODO(), authOptions); err != nil {
+		t.Errorf("rendered credential should authenticate, error: %v", err)
+	}
+}
+
+func TestMountEndToEndCleanup(t *testing.T) {
+	srv := openstacktest.NewServer(t)
+	client := newProviderConn(t, NewServer(provider.NewClient(time.Minute)))
+
+	attributes, _ := json.Marshal(map[string]string{
+		"applicationCredentials": `
+- fileName: clouds.yaml
+- fileName: other.conf
+  template: "{{ .AuthUrl }}"
+`,
+	})
+	secrets, _ := json.Marshal(srv.Credentials())
+	_, err := client.Mount(context.TODO(), &v1alpha1.MountRequest{
+		Attributes: string(attributes),
+		Secrets:    string(secrets),
+		TargetPath: "/openstack-auth",
+		Permission: "420",
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to render applicationCredentials[1]") {
+		t.Fatalf("expected render error, got %v", err)
+	}
+	// the credentials created before the failure are deleted again
+	if acs := srv.ApplicationCredentials(); len(acs) != 0 {
+		t.Errorf("application credentials of the failed Mount should be deleted, got %+v", acs)
+	}
+}
+
+func TestMountEndToEndTimeouts(t *testing.T) {
+	tests := map[string]struct {
+		server *CSIDriverProviderServer
+		// driverTimeout is the deadline of the driver, none if 0
+		driverTimeout time.Duration
+	}{
+		"call timeout": {
+			server: NewServer(provider.NewClient(time.Minute, provider.WithCallTimeout(100*time.Millisecond))),
+		},
+		"mount timeout": {
+			server: NewServer(provider.NewClient(time.Minute), WithMountTimeout(100*time.Millisecond)),
+		},
+		"driver deadline": {
+			server:        NewServer(provider.NewClient(time.Minute)),
+			driverTimeout: 100 * time.Millisecond,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := openstacktest.NewServer(t)
+			srv.Delay(time.Minute)
+			client := newProviderConn(t, tc.server)
+
+			attributes, _ := json.Marshal(map[string]string{"applicationCredentials": "- fileName: clouds.yaml\n"})
+			secrets, _ := json.Marshal(srv.Credentials())
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if tc.driverTimeout > 0 {
+				var cancelDriver context.CancelFunc
+				ctx, cancelDriver = context.WithTimeout(ctx, tc.driverTimeout)
+				defer cancelDriver()
+			}
+			start := time.Now()
+			_, err := client.Mount(ctx, &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    string(secrets),
+				TargetPath: "/openstack-auth",
+				Permission: "420",
+			})
+			if status.Code(err) != codes.DeadlineExceeded {
+				t.Fatalf("expected DeadlineExceeded, got %v", err)
+			}
+			// the driver deadline is reported by the gRPC client itself
+			if tc.driverTimeout == 0 && !strings.Contains(err.Error(), "applicationCredentials[0]") {
+				t.Errorf("expected the object in progress in %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("Mount should give up after 100ms, took %s", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"slices"
+)
+
+const (
+	FormatCloudsYAML string = "clouds.yaml"
+	FormatOpenRC     string = "openrc"
+	FormatEnv        string = "env"
+	FormatJSON       string = "json"
+	FormatOsloConfig string = "oslo.config"
+)
+
+const (
+	DefaultTemplate string = `clouds:
+  secrets-store-csi:
+    auth:
+      application_credential_id: {{ quote .AuthInfo.ApplicationCredentialID }}
+      application_credential_secret: {{ quote .AuthInfo.ApplicationCredentialSecret }}
+      auth_url: {{ quote .AuthInfo.AuthURL }}
+    auth_type: {{ quote .AuthType }}
+{{- with .RegionName }}
+    region_name: {{ quote . }}
+{{- end }}
+{{- with .Interface }}
+    interface: {{ quote . }}
+{{- end }}
+`
+
+	OpenRCTemplate string = `export OS_AUTH_TYPE={{ shquote .AuthType }}
+export OS_AUTH_URL={{ shquote .AuthInfo.AuthURL }}
+export OS_IDENTITY_API_VERSION=3
+export OS_APPLICATION_CREDENTIAL_ID={{ shquote .AuthInfo.ApplicationCredentialID }}
+export OS_APPLICATION_CREDENTIAL_SECRET={{ shquote .AuthInfo.ApplicationCredentialSecret }}
+{{- with .RegionName }}
+export OS_REGION_NAME={{ shquote . }}
+{{- end }}
+{{- with .Interface }}
+export OS_INTERFACE={{ shquote . }}
+{{- end }}
+`
+
+	EnvTemplate string = `OS_AUTH_TYPE={{ quote .AuthType }}
+OS_AUTH_URL={{ quote .AuthInfo.AuthURL }}
+OS_IDENTITY_API_VERSION="3"
+OS_APPLICATION_CREDENTIAL_ID={{ quote .AuthInfo.ApplicationCredentialID }}
+OS_APPLICATION_CREDENTIAL_SECRET={{ quote .AuthInfo.ApplicationCredentialSecret }}
+{{- with .RegionName }}
+OS_REGION_NAME={{ quote . }}
+{{- end }}
+{{- with .Interface }}
+OS_INTERFACE={{ quote . }}
+{{- end }}
+`
+
+	JSONTemplate string = `{
+  "auth_type": {{ toJson .AuthType }},
+  "auth": {
+    "auth_url": {{ toJson .AuthInfo.AuthURL }},
+    "application_credential_id": {{ toJson .AuthInfo.ApplicationCredentialID }},
+    "application_credential_secret": {{ toJson .AuthInfo.ApplicationCredentialSecret }}
+  }
+{{- with .RegionName }},
+  "region_name": {{ toJson . }}
+{{- end }}
+{{- with .Interface }},
+  "interface": {{ toJson . }}
+{{- end }}
+}
+`
+
+	OsloConfigTemplate string = `[keystone_authtoken]
+auth_type = {{ .AuthType }}
+auth_url = {{ .AuthInfo.AuthURL }}
+application_credential_id = {{ .AuthInfo.ApplicationCredentialID }}
+application_credential_secret = {{ .AuthInfo.ApplicationCredentialSecret }}
+{{- with .RegionName }}
+region_name = {{ . }}
+{{- end }}
+{{- with .Interface }}
+interface = {{ . }}
+{{- end }}
+`
+)
+
+// Formats are built-in templates selectable with the format field of an
+// object instead of providing a template
+var Formats = map[string]string{
+	FormatCloudsYAML: DefaultTemplate,
+	FormatOpenRC:     OpenRCTemplate,
+	FormatEnv:        EnvTemplate,
+	FormatJSON:       JSONTemplate,
+	FormatOsloConfig: OsloConfigTemplate,
+}
+
+// FormatNames returns sorted names of built-in Formats
+func FormatNames() []string {
+	names := make([]string, 0, len(Formats))
+	for name := range Formats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
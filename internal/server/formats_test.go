@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/yaml"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func goldenCloud() *Cloud {
+	return &Cloud{
+		AuthType: AuthV3ApplicationCredential,
+		AuthInfo: AuthInfo{
+			AuthURL:                     "https://keystone.server/identity/v3/",
+			ApplicationCredentialID:     "6cb5fa6a13184e6fab65ba2108adf50c",
+			ApplicationCredentialSecret: "it's-a-\"secret\"",
+			ApplicationCredentialName:   "secrets-store-csi-1742382787115467963-cnj2c",
+			ProjectID:                   "0c4e939acacf4376bdcd1129f1a054ad",
+			UserID:                      "9fe1d3",
+		},
+		RegionName: "RegionOne",
+		Interface:  "internal",
+		ExpiresAt:  time.Date(2025, 3, 19, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestFormats(t *testing.T) {
+	clouds := map[string]*Cloud{
+		"full":    goldenCloud(),
+		"minimal": {AuthType: AuthV3ApplicationCredential, AuthInfo: AuthInfo{AuthURL: "http://localhost:5000/v3/", ApplicationCredentialID: "abcdef1234", ApplicationCredentialSecret: "secret"}},
+	}
+
+	for _, format := range FormatNames() {
+		for variant, cloud := range clouds {
+			t.Run(format+"/"+variant, func(t *testing.T) {
+				object := ObjectFile{FileName: "out", Format: &format}
+				got, err := object.executeTemplate(cloud, newTemplateBudget(context.TODO(), 0))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				golden := filepath.Join("testdata", "formats", format+"."+variant+".golden")
+				if *update {
+					if err := os.WriteFile(golden, got, 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("failed to read golden file, run with -update to create it: %v", err)
+				}
+				if diff := cmp.Diff(string(want), string(got)); diff != "" {
+					t.Errorf("format %s mismatch (-want, +got):\n%s", format, diff)
+				}
+
+				switch format {
+				case FormatJSON:
+					if !json.Valid(got) {
+						t.Errorf("format %s produced invalid JSON", format)
+					}
+				case FormatCloudsYAML:
+					var v map[string]any
+					if err := yaml.Unmarshal(got, &v); err != nil {
+						t.Errorf("format %s produced invalid YAML: %v", format, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDefaultTemplateIsCloudsYAML(t *testing.T) {
+	cloud := goldenCloud()
+	format := FormatCloudsYAML
+	withFormat, err := ObjectFile{Format: &format}.executeTemplate(cloud, newTemplateBudget(context.TODO(), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withDefault, err := ObjectFile{}.executeTemplate(cloud, newTemplateBudget(context.TODO(), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(withDefault), string(withFormat)); diff != "" {
+		t.Errorf("default template and %s format mismatch (-want, +got):\n%s", format, diff)
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	template := "qwe"
+	unknown := "ini"
+	known := FormatOpenRC
+	tests := map[string]struct {
+		object  ObjectFile
+		wantErr string
+	}{
+		"no template and no format": {object: ObjectFile{FileName: "a"}},
+		"template":                  {object: ObjectFile{FileName: "a", Template: &template}},
+		"format":                    {object: ObjectFile{FileName: "a", Format: &known}},
+		"template and format":       {object: ObjectFile{FileName: "a", Template: &template, Format: &known}, wantErr: "mutually exclusive"},
+		"unknown format":            {object: ObjectFile{FileName: "a", Format: &unknown}, wantErr: `unknown format "ini"`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.object.Validate()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
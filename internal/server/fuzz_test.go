@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// fuzzApplicationCredentials seed the fuzz targets with the shapes used
+// throughout the tests
+var fuzzApplicationCredentials = []string{
+	"- fileName: clouds.yaml\n",
+	"- fileName: secure-clouds.yaml\n  template: \"qwe\"\n",
+	"- files:\n  - fileName: clouds.yaml\n  - fileName: openrc\n    format: openrc\n    mode: 0600\n  roles: [member]\n  expiresIn: 2h\n",
+	"- fileName: demo.yaml\n  projectName: demo\n  domainName: Default\n- fileName: other.yaml\n  projectID: abc\n",
+	"- fileName: east.yaml\n  cloud: east\n  region: RegionTwo\n",
+	"- fileName: keystone.conf\n  template: |\n    [keystone_authtoken]\n    auth_url = {{ .AuthInfo.AuthURL }}\n",
+	"- fileName: c.yaml\n  template: '{{ toYaml .Catalog | nindent 2 }}{{ range .Roles }}{{ .Name | quote }}{{ end }}'\n",
+	"- fileName: clouds.yaml\n-\n",
+	"[]",
+}
+
+func FuzzParseApplicationCredentials(f *testing.F) {
+	for _, seed := range fuzzApplicationCredentials {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, applicationCredentials string) {
+		objects, err := ParseApplicationCredentials(map[string]string{"applicationCredentials": applicationCredentials})
+		if err != nil {
+			return
+		}
+		// objects share a budget as in Mount
+		budget := newTemplateBudget(context.TODO(), DefaultTemplateTimeout)
+		var responseSize int
+		for i, object := range objects {
+			if object == nil {
+				t.Fatal("valid objects should not be nil")
+			}
+			if err := object.Validate(); err != nil {
+				t.Fatalf("parsed applicationCredentials[%d] should be valid, error: %v", i, err)
+			}
+			// objects which passed validation are safe to use
+			object.Scope()
+			// rendering may fail depending on the credential, but within
+			// bounds
+			files, err := object.Render(&applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, MountContext{}, budget)
+			if err != nil {
+				continue
+			}
+			for _, file := range files {
+				if len(file.Contents) > MaxFileSize {
+					t.Fatalf("rendered %d bytes of %q, more than %d", len(file.Contents), file.Path, MaxFileSize)
+				}
+				responseSize += len(file.Contents)
+			}
+			if responseSize > MaxMountResponseSize {
+				t.Fatalf("rendered %d bytes in total, more than %d", responseSize, MaxMountResponseSize)
+			}
+		}
+	})
+}
+
+func FuzzTemplate(f *testing.F) {
+	for _, seed := range []string{
+		"qwe",
+		DefaultTemplate,
+		OpenRCTemplate,
+		JSONTemplate,
+		"{{ indent 2 .AuthInfo.AuthURL }}",
+		"{{ .AuthInfo.ApplicationCredentialSecret | b64enc | b64dec }}",
+		"{{ date \"2006-01-02\" .ExpiresAt }}",
+		"{{ default \"x\" .RegionName | upper }}",
+		// pathological templates are rejected within bounds
+		"{{ range 100000000000 }}{{ end }}",
+		"{{ range 1000 }}{{ range 1000 }}{{ range 1000 }}{{ end }}{{ end }}{{ end }}",
+		`{{ $x := "ab" }}{{ range 40 }}{{ $x = printf "%s%s" $x $x }}{{ end }}`,
+		`{{ $x := "ab" }}{{ range 40 }}{{ $x = print $x $x }}{{ end }}`,
+		`{{ define "a" }}{{ template "a" }}{{ template "a" }}{{ end }}{{ template "a" }}`,
+		`{{ range .Catalog }}{{ range $.Catalog }}{{ range $.Roles }}{{ toYaml $ | nindent 1024 }}{{ end }}{{ end }}{{ end }}`,
+		`{{ $layout := printf "%01000d" 0 }}{{ .ExpiresAt.Format $layout }}`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, tmpl string) {
+		file := ObjectFile{FileName: "file", Template: &tmpl}
+		if err := file.Validate(); err != nil {
+			return
+		}
+		// execution may fail depending on the data, but within bounds
+		contents, err := file.executeTemplate(sampleCloud(), newTemplateBudget(context.TODO(), DefaultTemplateTimeout))
+		if err == nil && len(contents) > MaxFileSize {
+			t.Fatalf("rendered %d bytes, more than %d", len(contents), MaxFileSize)
+		}
+	})
+}
+
+func FuzzMount(f *testing.F) {
+	attributes := func(applicationCredentials string) string {
+		b, _ := json.Marshal(map[string]string{
+			"applicationCredentials":           applicationCredentials,
+			"csi.storage.k8s.io/pod.namespace": "default",
+			"csi.storage.k8s.io/pod.name":      "app",
+		})
+		return string(b)
+	}
+	for _, seed := range fuzzApplicationCredentials {
+		f.Add(attributes(seed), testSecrets, "640")
+	}
+	f.Add(`{}`, `{}`, `0`)
+	f.Add(`null`, `null`, `null`)
+	f.Add(attributes("- fileName: clouds.yaml\n"), `{"clouds.yaml": "clouds: {a: {auth: {auth_url: x}}}", "OS_CLOUD": "a"}`, "420")
+	f.Add(attributes("- fileName: clouds.yaml\n"), `{"OS_TRUST_ID": "trust"}`, "420")
+
+	server := NewServer(MockedProviderClient{
+		MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+			if _, err := createOpts.ToApplicationCredentialCreateMap(); err != nil {
+				return nil, nil, err
+			}
+			return &applicationcredentials.ApplicationCredential{ID: "id"}, &gophercloud.ServiceClient{}, nil
+		},
+	})
+	f.Fuzz(func(t *testing.T, attributes, secrets, permission string) {
+		response, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+			Attributes: attributes,
+			Secrets:    secrets,
+			TargetPath: "/openstack-auth",
+			Permission: permission,
+		})
+		if err == nil && response == nil {
+			t.Fatal("response should not be nil without an error")
+		}
+	})
+}
+
+// sampleCloud returns Cloud with every field populated
+func sampleCloud() *Cloud {
+	return &Cloud{
+		AuthType: AuthV3ApplicationCredential,
+		AuthInfo: AuthInfo{
+			AuthURL:                     "https://keystone.example.com/v3/",
+			ApplicationCredentialID:     "application-credential-id",
+			ApplicationCredentialSecret: "application-credential-secret",
+			ApplicationCredentialName:   "application-credential-name",
+			ProjectID:                   "project-id",
+			ProjectName:                 "project-name",
+			ProjectDomainID:             "project-domain-id",
+			ProjectDomainName:           "project-domain-name",
+			UserID:                      "user-id",
+			Username:                    "username",
+			UserDomainID:                "user-domain-id",
+			UserDomainName:              "user-domain-name",
+		},
+		RegionName: "region-name",
+		Interface:  "public",
+		ExpiresAt:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Roles:      []Role{{ID: "role-id", Name: "role-name", DomainID: "role-domain-id"}},
+		Catalog: []CatalogEntry{{
+			ID:   "service-id",
+			Name: "service-name",
+			Type: "service-type",
+			Endpoints: []Endpoint{{
+				ID:        "endpoint-id",
+				Region:    "region-name",
+				RegionID:  "region-id",
+				Interface: "public",
+				URL:       "https://service.example.com/",
+			}},
+		}},
+		Pod: Pod{
+			Namespace:          "namespace",
+			Name:               "name",
+			UID:                "uid",
+			ServiceAccountName: "service-account-name",
+		},
+	}
+}
@@ -0,0 +1,422 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Templates come from SecretProviderClasses, yet run in the node-level
+// provider process, so their resources are bounded
+const (
+	// MaxTemplateSize is the maximum size of a template in bytes
+	MaxTemplateSize = 64 << 10
+	// MaxFileSize is the maximum size of a rendered file in bytes, and of any
+	// string produced by template functions
+	MaxFileSize = 1 << 20
+	// MaxMountResponseSize is the maximum size of all files of a Mount in
+	// bytes, below the 4 MiB default gRPC message size limit of the driver
+	MaxMountResponseSize = 3 << 20
+	// MaxTemplateSteps bounds the work of the templates of a Mount, counted
+	// as the source size of every list of nodes each time it runs, e.g. of a
+	// range body per iteration
+	MaxTemplateSteps = 8 << 20
+	// MaxTemplateValuesSize is the maximum total size in bytes of strings
+	// produced by template functions during a Mount
+	MaxTemplateValuesSize = 16 << 20
+	// MaxObjectFiles is the maximum number of files of an
+	// applicationCredentials entry
+	MaxObjectFiles = 20
+	// DefaultTemplateTimeout bounds the time spent executing the templates of
+	// a Mount, unless configured otherwise
+	DefaultTemplateTimeout = time.Second
+)
+
+// limitedWriter buffers template output, failing writes past its size limit,
+// which aborts the template execution
+type limitedWriter struct {
+	limit int
+	buf   bytes.Buffer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > w.limit {
+		return 0, fmt.Errorf("output exceeds %d bytes", w.limit)
+	}
+	return w.buf.Write(p)
+}
+
+// templateBudget bounds the template executions of a Mount. Templates run
+// synchronously, so every loop and every function producing strings is
+// accounted, and the time spent is checked on every step.
+type templateBudget struct {
+	ctx context.Context
+	// timeout bounds the total time of all executions, not limited if 0
+	timeout time.Duration
+	// elapsed is the time of finished executions, started the start of the
+	// current one
+	elapsed time.Duration
+	started time.Time
+	steps   int
+	size    int
+	// output is the size of the files rendered so far
+	output int
+}
+
+// newTemplateBudget returns a budget for executions until ctx is done, and
+// for at most timeout in total if not 0
+func newTemplateBudget(ctx context.Context, timeout time.Duration) *templateBudget {
+	return &templateBudget{ctx: ctx, timeout: timeout}
+}
+
+// execute executes an instrumented template with the funcs of the budget,
+// its output accounted against MaxMountResponseSize
+func (b *templateBudget) execute(t *template.Template, w io.Writer, data any) error {
+	t.Funcs(b.funcs())
+	b.started = time.Now()
+	err := t.Execute(outputWriter{w: w, budget: b}, data)
+	b.elapsed += time.Since(b.started)
+	return err
+}
+
+// outputWriter accounts the files rendered during a Mount, failing writes
+// past MaxMountResponseSize
+type outputWriter struct {
+	w      io.Writer
+	budget *templateBudget
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	if w.budget.output+len(p) > MaxMountResponseSize {
+		return 0, fmt.Errorf("files of applicationCredentials exceed %d bytes", MaxMountResponseSize)
+	}
+	n, err := w.w.Write(p)
+	w.budget.output += n
+	return n, err
+}
+
+// step is called by every list of nodes of an instrumented template
+func (b *templateBudget) step(weight int) (string, error) {
+	b.steps += weight
+	if b.steps > MaxTemplateSteps {
+		return "", fmt.Errorf("template execution exceeds %d steps", MaxTemplateSteps)
+	}
+	if err := b.ctx.Err(); err != nil {
+		return "", err
+	}
+	if b.timeout > 0 && b.elapsed+time.Since(b.started) > b.timeout {
+		return "", fmt.Errorf("template execution exceeds %s", b.timeout)
+	}
+	return "", nil
+}
+
+// alloc accounts a string of n bytes produced by a function
+func (b *templateBudget) alloc(n int) error {
+	if n > MaxFileSize {
+		return fmt.Errorf("value exceeds %d bytes", MaxFileSize)
+	}
+	b.size += n
+	if b.size > MaxTemplateValuesSize {
+		return fmt.Errorf("values of template functions exceed %d bytes in total", MaxTemplateValuesSize)
+	}
+	return nil
+}
+
+// funcs returns templateFuncs and the text/template builtins producing
+// strings, bounded by the budget, and the step function of instrument
+func (b *templateBudget) funcs() map[string]any {
+	funcs := map[string]any{"step": b.step}
+	for name, fn := range templateFuncs {
+		if reflect.TypeOf(fn).Out(0).Kind() == reflect.String {
+			fn = b.bounded(fn)
+		}
+		funcs[name] = fn
+	}
+	funcs["html"] = b.bounded(template.HTMLEscaper)
+	funcs["js"] = b.bounded(template.JSEscaper)
+	funcs["urlquery"] = b.bounded(template.URLQueryEscaper)
+	// the size of their results is only known afterwards, so it is estimated
+	// upfront for a single call not to allocate arbitrary amounts of memory
+	funcs["print"] = b.bounded(func(args ...any) (string, error) {
+		if estimate := len(args) + valuesSize(args); estimate > MaxFileSize {
+			return "", fmt.Errorf("value would exceed %d bytes", MaxFileSize)
+		}
+		return fmt.Sprint(args...), nil
+	})
+	funcs["println"] = b.bounded(func(args ...any) (string, error) {
+		if estimate := len(args) + valuesSize(args); estimate > MaxFileSize {
+			return "", fmt.Errorf("value would exceed %d bytes", MaxFileSize)
+		}
+		return fmt.Sprintln(args...), nil
+	})
+	funcs["printf"] = b.bounded(func(format string, args ...any) (string, error) {
+		if printfSize(format, args) > MaxFileSize {
+			return "", fmt.Errorf("value would exceed %d bytes", MaxFileSize)
+		}
+		return fmt.Sprintf(format, args...), nil
+	})
+	funcs["indent"] = b.bounded(func(spaces int, s string) (string, error) {
+		if len(s)+max(spaces, 0)*(strings.Count(s, "\n")+1) > MaxFileSize {
+			return "", fmt.Errorf("value would exceed %d bytes", MaxFileSize)
+		}
+		return indent(spaces, s)
+	})
+	funcs["nindent"] = b.bounded(func(spaces int, s string) (string, error) {
+		if 1+len(s)+max(spaces, 0)*(strings.Count(s, "\n")+1) > MaxFileSize {
+			return "", fmt.Errorf("value would exceed %d bytes", MaxFileSize)
+		}
+		return nindent(spaces, s)
+	})
+	return funcs
+}
+
+// bounded wraps fn, returning a string and optionally an error, into a
+// function of the same arguments accounting its result
+func (b *templateBudget) bounded(fn any) any {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	in := make([]reflect.Type, t.NumIn())
+	for i := range in {
+		in[i] = t.In(i)
+	}
+	out := []reflect.Type{reflect.TypeFor[string](), reflect.TypeFor[error]()}
+	return reflect.MakeFunc(reflect.FuncOf(in, out, t.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+		var results []reflect.Value
+		if t.IsVariadic() {
+			results = v.CallSlice(args)
+		} else {
+			results = v.Call(args)
+		}
+		s := results[0].String()
+		var err error
+		if len(results) > 1 && !results[1].IsNil() {
+			err = results[1].Interface().(error)
+		} else {
+			err = b.alloc(len(s))
+		}
+		if err != nil {
+			s = ""
+		}
+		return []reflect.Value{reflect.ValueOf(s), reflect.ValueOf(&err).Elem()}
+	}).Interface()
+}
+
+// printfVerbSize bounds the output of a verb beyond its operand and explicit
+// width or precision, e.g. the digits of a large float
+const printfVerbSize = 1024
+
+// printfSize estimates an upper bound of the size of fmt.Sprintf output
+func printfSize(format string, args []any) int {
+	verbs := strings.Count(format, "%")
+	// operands are only consumed in order without explicit argument indexes
+	// or widths taken from arguments
+	if strings.ContainsAny(format, "[*") {
+		// fmt ignores widths and precisions above 1e6
+		return len(format) + verbs*(maxValueSize(args)+printfVerbSize+2e6)
+	}
+	size := len(format) + verbs*printfVerbSize + valuesSize(args)
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		// width and precision
+		for range 2 {
+			j := i
+			for j < len(format) && '0' <= format[j] && format[j] <= '9' {
+				j++
+			}
+			if n, err := strconv.Atoi(format[i:j]); err == nil {
+				size += min(n, 1e6)
+			} else if j > i {
+				size += 1e6
+			}
+			i = j
+			if i >= len(format) || format[i] != '.' {
+				break
+			}
+			i++
+		}
+	}
+	return size
+}
+
+// valuesSize estimates the total size of formatted values, stopping once it
+// exceeds MaxFileSize
+func valuesSize(values []any) int {
+	size := 0
+	for _, value := range values {
+		size += valueSize(value)
+		if size > MaxFileSize {
+			break
+		}
+	}
+	return size
+}
+
+func maxValueSize(values []any) int {
+	size := 0
+	for _, value := range values {
+		size = max(size, valueSize(value))
+	}
+	return size
+}
+
+// valueSize estimates the size of the value formatted with any verb, values
+// of templates are either strings bounded by the budget, or the data
+func valueSize(value any) int {
+	switch value := value.(type) {
+	case string:
+		return len(value)
+	case []byte:
+		return len(value)
+	}
+	// the Go syntax representation is the longest, with field and type names
+	return len(fmt.Sprintf("%#v", value))
+}
+
+// instrument prepares the parsed templates for a bounded execution with the
+// funcs of a templateBudget. Every list of nodes, e.g. a range body or a
+// defined template, calls step first, weighted by its size. Methods of the
+// data may only be called with literal arguments, as their results can not
+// be accounted.
+func instrument(t *template.Template) error {
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		if _, err := instrumentList(tmpl.Tree, tmpl.Tree.Root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stepWeight is the weight of running a list of nodes beyond their size, it
+// costs about as much as executing as many bytes of source
+const stepWeight = 32
+
+// instrumentList prepends list with a step and returns its weight
+func instrumentList(tree *parse.Tree, list *parse.ListNode) (int, error) {
+	if list == nil {
+		return 0, nil
+	}
+	weight := stepWeight
+	for _, node := range list.Nodes {
+		var n int
+		var err error
+		switch node := node.(type) {
+		case *parse.IfNode:
+			n, err = instrumentBranch(tree, &node.BranchNode)
+		case *parse.RangeNode:
+			n, err = instrumentBranch(tree, &node.BranchNode)
+		case *parse.WithNode:
+			n, err = instrumentBranch(tree, &node.BranchNode)
+		case *parse.ActionNode:
+			n, err = checkPipe(tree, node.Pipe)
+			n = n*stepWeight + len(node.String())
+		case *parse.TemplateNode:
+			n, err = checkPipe(tree, node.Pipe)
+			n = n*stepWeight + len(node.String())
+		default:
+			n = len(node.String())
+		}
+		if err != nil {
+			return 0, err
+		}
+		weight += n
+	}
+
+	pos := list.Position()
+	step := parse.NewIdentifier("step").SetPos(pos)
+	list.Nodes = slices.Insert(list.Nodes, 0, parse.Node(&parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      pos,
+				Args: []parse.Node{step, &parse.NumberNode{
+					NodeType: parse.NodeNumber,
+					Pos:      pos,
+					IsInt:    true,
+					Int64:    int64(weight),
+					Text:     strconv.Itoa(weight),
+				}},
+			}},
+		},
+	}))
+	return weight, nil
+}
+
+func instrumentBranch(tree *parse.Tree, branch *parse.BranchNode) (int, error) {
+	commands, err := checkPipe(tree, branch.Pipe)
+	if err != nil {
+		return 0, err
+	}
+	n, err := instrumentList(tree, branch.List)
+	if err != nil {
+		return 0, err
+	}
+	m, err := instrumentList(tree, branch.ElseList)
+	if err != nil {
+		return 0, err
+	}
+	return commands*stepWeight + len(branch.Pipe.String()) + n + m, nil
+}
+
+// checkPipe rejects method calls with arguments other than literals, and
+// returns the number of commands, e.g. function calls. Fields and variables
+// given arguments, or a piped value, can only be methods.
+func checkPipe(tree *parse.Tree, pipe *parse.PipeNode) (int, error) {
+	if pipe == nil {
+		return 0, nil
+	}
+	commands := len(pipe.Cmds)
+	for i, cmd := range pipe.Cmds {
+		switch cmd.Args[0].(type) {
+		case *parse.FieldNode, *parse.ChainNode, *parse.VariableNode:
+			location, _ := tree.ErrorContext(cmd)
+			if i > 0 {
+				return 0, fmt.Errorf("template: %s: methods should not be given piped values, got %s", location, cmd)
+			}
+			for _, arg := range cmd.Args[1:] {
+				switch arg.(type) {
+				case *parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+				default:
+					return 0, fmt.Errorf("template: %s: methods should only be given literal arguments, got %s", location, cmd)
+				}
+			}
+		}
+		for _, arg := range cmd.Args {
+			if chain, ok := arg.(*parse.ChainNode); ok {
+				arg = chain.Node
+			}
+			if pipe, ok := arg.(*parse.PipeNode); ok {
+				n, err := checkPipe(tree, pipe)
+				if err != nil {
+					return 0, err
+				}
+				commands += n
+			}
+		}
+	}
+	return commands, nil
+}
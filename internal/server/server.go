@@ -5,12 +5,22 @@
 package server
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"os"
+	"text/template"
+	"time"
 
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/policy"
 	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/provider"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 	"sigs.k8s.io/yaml"
 )
@@ -18,14 +28,94 @@ import (
 type CSIDriverProviderServer struct {
 	v1alpha1.UnimplementedCSIDriverProviderServer
 	ProviderClient provider.ProviderClient
+	NameTemplate   *template.Template
+	// Policy restricts what may be requested, everything is allowed if nil
+	Policy *policy.Store
+	// DefaultCredentials are used when no nodePublishSecretRef is provided,
+	// if allowed by Policy
+	DefaultCredentials provider.CredentialsSource
+	// DefaultExpiresIn is the lifetime of credentials not setting expiresIn,
+	// DefaultExpiresIn of the package if 0
+	DefaultExpiresIn time.Duration
+	// MountTimeout bounds a whole Mount in addition to the deadline of the
+	// driver, not limited if 0
+	MountTimeout time.Duration
+	// RenewBefore is how long before expiry credentials are renewed on
+	// rotation polls, they are renewed on every poll if 0
+	RenewBefore time.Duration
+	// TemplateTimeout bounds the time spent executing the templates of a
+	// Mount, not limited if 0
+	TemplateTimeout time.Duration
 }
 
-func NewServer(providerClient provider.ProviderClient) *CSIDriverProviderServer {
-	return &CSIDriverProviderServer{
-		ProviderClient: providerClient,
+type Option func(*CSIDriverProviderServer)
+
+// WithNameTemplate sets the template generating application credential
+// names, see NewNameTemplate
+func WithNameTemplate(nameTemplate *template.Template) Option {
+	return func(s *CSIDriverProviderServer) {
+		s.NameTemplate = nameTemplate
+	}
+}
+
+// WithPolicy enforces the policy on every Mount
+func WithPolicy(policy *policy.Store) Option {
+	return func(s *CSIDriverProviderServer) {
+		s.Policy = policy
 	}
 }
 
+// WithDefaultCredentials sets credentials used for Pods without
+// nodePublishSecretRef. Their use must be allowed by the policy.
+func WithDefaultCredentials(source provider.CredentialsSource) Option {
+	return func(s *CSIDriverProviderServer) {
+		s.DefaultCredentials = source
+	}
+}
+
+// WithDefaultExpiresIn sets the lifetime of credentials not setting expiresIn
+func WithDefaultExpiresIn(expiresIn time.Duration) Option {
+	return func(s *CSIDriverProviderServer) {
+		s.DefaultExpiresIn = expiresIn
+	}
+}
+
+// WithMountTimeout bounds a whole Mount in addition to the deadline of the
+// driver
+func WithMountTimeout(timeout time.Duration) Option {
+	return func(s *CSIDriverProviderServer) {
+		s.MountTimeout = timeout
+	}
+}
+
+// WithRenewBefore keeps mounted credentials on rotation polls until they
+// expire within renewBefore
+func WithRenewBefore(renewBefore time.Duration) Option {
+	return func(s *CSIDriverProviderServer) {
+		s.RenewBefore = renewBefore
+	}
+}
+
+// WithTemplateTimeout bounds the time spent executing the templates of a
+// Mount
+func WithTemplateTimeout(timeout time.Duration) Option {
+	return func(s *CSIDriverProviderServer) {
+		s.TemplateTimeout = timeout
+	}
+}
+
+func NewServer(providerClient provider.ProviderClient, opts ...Option) *CSIDriverProviderServer {
+	s := &CSIDriverProviderServer{
+		ProviderClient:  providerClient,
+		NameTemplate:    template.Must(NewNameTemplate(DefaultNameTemplate)),
+		TemplateTimeout: DefaultTemplateTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
 func (s *CSIDriverProviderServer) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1alpha1.VersionResponse, error) {
 	return &v1alpha1.VersionResponse{
 		Version:        "v1alpha1",
@@ -34,6 +124,46 @@ func (s *CSIDriverProviderServer) Version(ctx context.Context, req *v1alpha1.Ver
 	}, nil
 }
 
+const (
+	// maxApplicationCredentialsSize and maxApplicationCredentials bound the work
+	// a single SecretProviderClass may cause
+	maxApplicationCredentialsSize = 256 << 10
+	maxApplicationCredentials     = 100
+)
+
+// ParseApplicationCredentials parses and validates the applicationCredentials
+// of SecretProviderClass.spec.parameters, which the driver passes to Mount as
+// attributes. Unknown fields are rejected.
+func ParseApplicationCredentials(parameters map[string]string) ([]*ApplicationCredentialObject, error) {
+	applicationCredentialAttribute, ok := parameters["applicationCredentials"]
+	// if Barbican `secrets` are added, it would have to account for both
+	if !ok || applicationCredentialAttribute == "" {
+		return nil, fmt.Errorf("applicationCredentials should be provided via SecretProviderClass.spec.attributes.applicationCredentials")
+	}
+	if len(applicationCredentialAttribute) > maxApplicationCredentialsSize {
+		return nil, fmt.Errorf("applicationCredentials should not exceed %d bytes", maxApplicationCredentialsSize)
+	}
+	var applicationCredentialsObjects []*ApplicationCredentialObject
+	err := yaml.UnmarshalStrict([]byte(applicationCredentialAttribute), &applicationCredentialsObjects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal applicationCredentials, error: %w", err)
+	}
+	if len(applicationCredentialsObjects) > maxApplicationCredentials {
+		return nil, fmt.Errorf("applicationCredentials should not have more than %d entries", maxApplicationCredentials)
+	}
+
+	for i, applicationCredentialObject := range applicationCredentialsObjects {
+		// an empty list item decodes as nil
+		if applicationCredentialObject == nil {
+			return nil, fmt.Errorf("invalid applicationCredentials[%d], error: entry should not be empty", i)
+		}
+		if err := applicationCredentialObject.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid applicationCredentials[%d], error: %w", i, err)
+		}
+	}
+	return applicationCredentialsObjects, nil
+}
+
 func (s *CSIDriverProviderServer) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error) {
 	var attributes, secrets map[string]string
 	var filePermission os.FileMode
@@ -43,6 +173,12 @@ func (s *CSIDriverProviderServer) Mount(ctx context.Context, req *v1alpha1.Mount
 		return nil, fmt.Errorf("request should have a target mount path")
 	}
 
+	if s.MountTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.MountTimeout)
+		defer cancel()
+	}
+
 	// attributes correspond to SecretProviderClass.spec.attributes
 	if req.GetAttributes() == "" {
 		return nil, fmt.Errorf("parameters provided in SecretProviderClass should not be empty")
@@ -62,61 +198,157 @@ func (s *CSIDriverProviderServer) Mount(ctx context.Context, req *v1alpha1.Mount
 	// 5 = csi.storage.k8s.io/serviceAccount.name -> default
 	// 6 = secretProviderClass -> my-openstack
 
-	// secrets is the Secret content referenced in nodePublishSecretRef Secret data
-	if req.GetSecrets() == "" {
-		return nil, fmt.Errorf("secrets should be provided via volume.csi.nodePublishSecretRef.name")
+	// secrets is the Secret content referenced in nodePublishSecretRef Secret
+	// data, the driver sends an empty map if there is no nodePublishSecretRef
+	if req.GetSecrets() != "" {
+		if err = json.Unmarshal([]byte(req.GetSecrets()), &secrets); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal nodePublishSecretRef secrets, error: %w", err)
+		}
 	}
-	if err = json.Unmarshal([]byte(req.GetSecrets()), &secrets); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal nodePublishSecretRef secrets, error: %w", err)
+	// a Secret with just OS_TRUST_ID delegates to the default credentials,
+	// e.g. of a service user trusted by the project owner
+	var trustID string
+	if len(secrets) == 1 && secrets["OS_TRUST_ID"] != "" && s.DefaultCredentials != nil {
+		trustID = secrets["OS_TRUST_ID"]
 	}
-	if secrets == nil {
-		return nil, fmt.Errorf("secrets should not be nil")
+	useDefaultCredentials := len(secrets) == 0 || trustID != ""
+	if useDefaultCredentials && s.DefaultCredentials == nil {
+		return nil, fmt.Errorf("secrets should be provided via volume.csi.nodePublishSecretRef.name")
 	}
 
 	if err = json.Unmarshal([]byte(req.GetPermission()), &filePermission); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal file permission, error: %w", err)
 	}
 
-	// req.GetCurrentObjectVersion()
+	applicationCredentialsObjects, err := ParseApplicationCredentials(attributes)
+	if err != nil {
+		return nil, err
+	}
+	if s.DefaultExpiresIn != 0 {
+		for _, applicationCredentialObject := range applicationCredentialsObjects {
+			if applicationCredentialObject.ExpiresIn == nil {
+				applicationCredentialObject.ExpiresIn = &Duration{s.DefaultExpiresIn}
+			}
+		}
+	}
 
-	applicationCredentialAttribute, ok := attributes["applicationCredentials"]
-	// if Barbican `secrets` are added, it would have to account for both
-	if !ok || applicationCredentialAttribute == "" {
-		return nil, fmt.Errorf("applicationCredentials should be provided via SecretProviderClass.spec.attributes.applicationCredentials")
+	pod := newPod(attributes)
+	for i, applicationCredentialObject := range applicationCredentialsObjects {
+		err := s.Policy.Authorize(policy.Request{
+			Namespace:          pod.Namespace,
+			ServiceAccount:     pod.ServiceAccountName,
+			ObjectType:         "applicationCredentials",
+			Roles:              applicationCredentialObject.Roles,
+			ExpiresIn:          applicationCredentialObject.GetExpiresIn(),
+			DefaultCredentials: useDefaultCredentials,
+			TrustID:            trustID,
+			Project:            cmp.Or(applicationCredentialObject.ProjectID, applicationCredentialObject.ProjectName),
+			Cloud:              applicationCredentialObject.Cloud,
+			Region:             applicationCredentialObject.Region,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("applicationCredentials[%d] denied by policy, error: %w", i, err)
+		}
 	}
-	var applicationCredentialsObjects []*ApplicationCredentialObject
-	err = yaml.Unmarshal([]byte(applicationCredentialAttribute), &applicationCredentialsObjects)
+
+	if useDefaultCredentials {
+		secrets, err = s.DefaultCredentials.Credentials()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get default credentials, error: %w", err)
+		}
+		if trustID != "" {
+			secrets = maps.Clone(secrets)
+			secrets["OS_TRUST_ID"] = trustID
+		}
+	}
+
+	creds, err := parseCredentials(secrets)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal applicationCredentials, error: %w", err)
+		return nil, err
+	}
+	auths := make([]map[string]string, len(applicationCredentialsObjects))
+	for i, applicationCredentialObject := range applicationCredentialsObjects {
+		auths[i], err = creds.forObject(applicationCredentialObject.Cloud, applicationCredentialObject.Region)
+		if err != nil {
+			return nil, fmt.Errorf("invalid applicationCredentials[%d], error: %w", i, err)
+		}
+	}
+
+	// rotation polls pass the versions of the mounted credentials, which are
+	// kept by returning them without files
+	if s.RenewBefore > 0 && currentVersionsValid(req.GetCurrentObjectVersion(), applicationCredentialsObjects, auths, s.RenewBefore, time.Now()) {
+		return &v1alpha1.MountResponse{ObjectVersion: req.GetCurrentObjectVersion()}, nil
 	}
 
 	mountResponse := &v1alpha1.MountResponse{}
+	// templates of all objects share a budget, bounding the work and the
+	// response size of a Mount
+	budget := newTemplateBudget(ctx, s.TemplateTimeout)
+	// the driver retries failed Mounts, so credentials created by one are
+	// deleted rather than left behind
+	var created []createdApplicationCredential
+	fail := func(err error) (*v1alpha1.MountResponse, error) {
+		s.deleteApplicationCredentials(ctx, created)
+		return nil, err
+	}
 
-	for _, applicationCredentialObject := range applicationCredentialsObjects {
-		applicationCredential, identityClient, err := s.ProviderClient.CreateApplicationCredential(ctx, secrets, applicationCredentialObject)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create application credential %+v, error: %w", applicationCredentialObject, err)
+	for i, applicationCredentialObject := range applicationCredentialsObjects {
+		mountContext := newMountContext(attributes, auths[i])
+		createOpts := applicationCredentialCreateOpts{
+			object:       applicationCredentialObject,
+			mountContext: mountContext,
+			nameTemplate: s.NameTemplate,
+		}
+		applicationCredential, identityClient, err := s.ProviderClient.CreateApplicationCredential(ctx, auths[i], applicationCredentialObject.Scope(), createOpts)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fail(status.Errorf(codes.DeadlineExceeded, "timed out creating application credential of applicationCredentials[%d], error: %v", i, err))
+		}
+		if errors.Is(err, context.Canceled) {
+			return fail(status.Errorf(codes.Canceled, "canceled creating application credential of applicationCredentials[%d], error: %v", i, err))
 		}
-
-		contents, err := applicationCredentialObject.Render(applicationCredential, identityClient)
 		if err != nil {
-			return nil, fmt.Errorf("failed to render contents for application credential %+v, error: %w", applicationCredentialObject, err)
+			return fail(fmt.Errorf("failed to create application credential %+v, error: %w", applicationCredentialObject, err))
 		}
+		created = append(created, createdApplicationCredential{identityClient: identityClient, id: applicationCredential.ID})
 
-		file := &v1alpha1.File{
-			Contents: contents,
-			Path:     applicationCredentialObject.FileName,
+		files, err := applicationCredentialObject.Render(applicationCredential, identityClient, mountContext, budget)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fail(status.Errorf(codes.DeadlineExceeded, "timed out rendering applicationCredentials[%d], error: %v", i, err))
+		}
+		if err != nil {
+			return fail(fmt.Errorf("failed to render applicationCredentials[%d], error: %w", i, err))
 		}
-		mountResponse.Files = append(mountResponse.Files, file)
+		mountResponse.Files = append(mountResponse.Files, files...)
 
 		objectVersion := &v1alpha1.ObjectVersion{
 			Id: applicationCredential.ID,
-			// not clear which attribute of AC to use as version, so just user some fixed
-			// value all the time
-			Version: "v1",
+			// changes with the requested credential, its files and expiry,
+			// so the driver records e.g. altered access rules and renewals
+			Version: newCredentialVersion(applicationCredentialObject, auths[i], applicationCredential.ExpiresAt).String(),
 		}
 		mountResponse.ObjectVersion = append(mountResponse.ObjectVersion, objectVersion)
 	}
 
 	return mountResponse, nil
 }
+
+// deleteTimeout bounds deleting the credentials of a failed Mount, which may
+// have failed because its context is done
+const deleteTimeout = 30 * time.Second
+
+type createdApplicationCredential struct {
+	identityClient *gophercloud.ServiceClient
+	id             string
+}
+
+// deleteApplicationCredentials deletes credentials created by a failed Mount,
+// logging those which could not be deleted
+func (s *CSIDriverProviderServer) deleteApplicationCredentials(ctx context.Context, created []createdApplicationCredential) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deleteTimeout)
+	defer cancel()
+	for _, c := range created {
+		if err := s.ProviderClient.DeleteApplicationCredential(ctx, c.identityClient, c.id); err != nil {
+			slog.Warn("Failed to delete application credential of a failed Mount", "id", c.id, "error", err)
+		}
+	}
+}
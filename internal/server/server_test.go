@@ -7,23 +7,70 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gophercloud/gophercloud/v2"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/policy"
 	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/provider"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/testing/protocmp"
 	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
 
+// defaultVersion is the object version of entries requesting a credential
+// with all defaults
+var defaultVersion = ApplicationCredentialObject{}.Fingerprint()
+
+// testSecrets stand for nodePublishSecretRef Secret contents
+const testSecrets = `{"OS_AUTH_URL": "http://localhost:5000/v3/"}`
+
+// testDigest returns the versionDigest of the only applicationCredentials
+// entry of the request
+func testDigest(t *testing.T, req *v1alpha1.MountRequest) string {
+	t.Helper()
+	var attributes, secrets map[string]string
+	if err := json.Unmarshal([]byte(req.GetAttributes()), &attributes); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(req.GetSecrets()), &secrets); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := ParseApplicationCredentials(attributes)
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("expected a single applicationCredentials entry, got %d, error: %v", len(objects), err)
+	}
+	return versionDigest(objects[0], secrets)
+}
+
 type MockedProviderClient struct {
-	MockedCreateApplicationCredential func(ctx context.Context, auth map[string]string, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error)
+	MockedCreateApplicationCredential func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error)
+	// MockedDeleteApplicationCredential is optional, deleting succeeds if nil
+	MockedDeleteApplicationCredential func(ctx context.Context, identityClient *gophercloud.ServiceClient, id string) error
+}
+
+func (m MockedProviderClient) CreateApplicationCredential(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+	return m.MockedCreateApplicationCredential(ctx, auth, scope, createOpts)
 }
 
-func (m MockedProviderClient) CreateApplicationCredential(ctx context.Context, auth map[string]string, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
-	return m.MockedCreateApplicationCredential(ctx, auth, createOpts)
+func (m MockedProviderClient) DeleteApplicationCredential(ctx context.Context, identityClient *gophercloud.ServiceClient, id string) error {
+	if m.MockedDeleteApplicationCredential == nil {
+		return nil
+	}
+	return m.MockedDeleteApplicationCredential(ctx, identityClient, id)
 }
 
 func TestVersion(t *testing.T) {
@@ -53,6 +100,8 @@ func TestVersion(t *testing.T) {
 func TestMount(t *testing.T) {
 	tests := map[string]struct {
 		applicationCredentials string
+		attributes             map[string]string
+		secrets                string
 		filePath               string
 		contents               string
 		objectVersion          *v1alpha1.ObjectVersion
@@ -65,9 +114,9 @@ func TestMount(t *testing.T) {
 `,
 			filePath:      "secure-clouds.yaml",
 			contents:      "qwe",
-			objectVersion: &v1alpha1.ObjectVersion{Version: "v1"},
+			objectVersion: &v1alpha1.ObjectVersion{Version: defaultVersion},
 			server: NewServer(MockedProviderClient{
-				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
 					return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, nil
 				},
 			}),
@@ -85,9 +134,9 @@ func TestMount(t *testing.T) {
       auth_url: ""
     auth_type: "v3applicationcredential"
 `,
-			objectVersion: &v1alpha1.ObjectVersion{Version: "v1"},
+			objectVersion: &v1alpha1.ObjectVersion{Version: defaultVersion},
 			server: NewServer(MockedProviderClient{
-				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
 					return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, nil
 				},
 			}),
@@ -106,9 +155,9 @@ func TestMount(t *testing.T) {
       auth_url: "http://localhost:5000/v3/"
     auth_type: "v3applicationcredential"
 `,
-			objectVersion: &v1alpha1.ObjectVersion{Id: "abcdef1234", Version: "v1"},
+			objectVersion: &v1alpha1.ObjectVersion{Id: "abcdef1234", Version: defaultVersion},
 			server: NewServer(MockedProviderClient{
-				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
 					ac := &applicationcredentials.ApplicationCredential{
 						Name:   "secrets-store-csi-1742382787115467963-cnj2c",
 						ID:     "abcdef1234",
@@ -139,9 +188,9 @@ auth_type = v3applicationcredential
 application_credential_id = 6cb5fa6a13184e6fab65ba2108adf50c
 application_credential_secret= glance_secret
 `,
-			objectVersion: &v1alpha1.ObjectVersion{Id: "6cb5fa6a13184e6fab65ba2108adf50c", Version: "v1"},
+			objectVersion: &v1alpha1.ObjectVersion{Id: "6cb5fa6a13184e6fab65ba2108adf50c", Version: defaultVersion},
 			server: NewServer(MockedProviderClient{
-				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
 					ac := &applicationcredentials.ApplicationCredential{
 						ID:     "6cb5fa6a13184e6fab65ba2108adf50c",
 						Secret: "glance_secret",
@@ -153,6 +202,121 @@ application_credential_secret= glance_secret
 				},
 			}),
 		},
+
+		"applicationCredential with format": {
+			applicationCredentials: `
+- fileName: openrc
+  format: openrc
+`,
+			filePath: "openrc",
+			contents: `export OS_AUTH_TYPE='v3applicationcredential'
+export OS_AUTH_URL='http://localhost:5000/v3/'
+export OS_IDENTITY_API_VERSION=3
+export OS_APPLICATION_CREDENTIAL_ID='abcdef1234'
+export OS_APPLICATION_CREDENTIAL_SECRET='random-generated-secret'
+export OS_REGION_NAME='RegionOne'
+`,
+			secrets:       `{"OS_REGION_NAME": "RegionOne"}`,
+			objectVersion: &v1alpha1.ObjectVersion{Id: "abcdef1234", Version: defaultVersion},
+			server: NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					ac := &applicationcredentials.ApplicationCredential{
+						ID:     "abcdef1234",
+						Secret: "random-generated-secret",
+					}
+					sc := &gophercloud.ServiceClient{
+						ResourceBase: "http://localhost:5000/v3/",
+					}
+					return ac, sc, nil
+				},
+			}),
+		},
+
+		"applicationCredential with custom template using token and pod details": {
+			applicationCredentials: `
+- fileName: openrc
+  template: |
+    export OS_AUTH_URL={{ .AuthInfo.AuthURL }}
+    export OS_REGION_NAME={{ .RegionName }}
+    export OS_INTERFACE={{ .Interface }}
+    export OS_PROJECT_ID={{ .AuthInfo.ProjectID }}
+    export OS_PROJECT_NAME={{ .AuthInfo.ProjectName }}
+    export OS_USER_DOMAIN_NAME={{ .AuthInfo.UserDomainName }}
+    # user {{ .AuthInfo.UserID }} until {{ .ExpiresAt.Format "2006-01-02T15:04:05Z07:00" }}
+    # roles{{ range .Roles }} {{ .Name }}{{ end }}
+    # pod {{ .Pod.Namespace }}/{{ .Pod.Name }} ({{ .Pod.UID }}) as {{ .Pod.ServiceAccountName }}
+    {{- range .Catalog }}{{ if eq .Type "object-store" }}{{ range .Endpoints }}
+    # swift {{ .Interface }} {{ .URL }}
+    {{- end }}{{ end }}{{ end }}
+`,
+			attributes: map[string]string{
+				"csi.storage.k8s.io/pod.name":            "demo-app-7dc68c4b7f-sjc6l",
+				"csi.storage.k8s.io/pod.namespace":       "default",
+				"csi.storage.k8s.io/pod.uid":             "f64099e3-1962-4078-b995-8f0f2f04b33f",
+				"csi.storage.k8s.io/serviceAccount.name": "demo-app",
+			},
+			secrets:  `{"OS_REGION_NAME": "RegionOne", "OS_INTERFACE": "internal"}`,
+			filePath: "openrc",
+			contents: `export OS_AUTH_URL=https://keystone.server/identity/v3/
+export OS_REGION_NAME=RegionOne
+export OS_INTERFACE=internal
+export OS_PROJECT_ID=0c4e939acacf4376bdcd1129f1a054ad
+export OS_PROJECT_NAME=demo
+export OS_USER_DOMAIN_NAME=Default
+# user 9fe1d3 until 2025-03-19T12:00:00Z
+# roles member reader
+# pod default/demo-app-7dc68c4b7f-sjc6l (f64099e3-1962-4078-b995-8f0f2f04b33f) as demo-app
+# swift public https://swift.server/v1/AUTH_0c4e939acacf4376bdcd1129f1a054ad
+`,
+			objectVersion: &v1alpha1.ObjectVersion{Id: "6cb5fa6a13184e6fab65ba2108adf50c", Version: defaultVersion + "-1742382000-1742385600"},
+			server: NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					ac := &applicationcredentials.ApplicationCredential{
+						ID:        "6cb5fa6a13184e6fab65ba2108adf50c",
+						Secret:    "glance_secret",
+						ProjectID: "0c4e939acacf4376bdcd1129f1a054ad",
+						ExpiresAt: time.Date(2025, 3, 19, 12, 0, 0, 0, time.UTC),
+						Roles: []applicationcredentials.Role{
+							{ID: "1", Name: "member"},
+							{ID: "2", Name: "reader"},
+						},
+					}
+					token := tokens.CreateResult{}
+					token.Body = map[string]any{
+						"token": map[string]any{
+							"user": map[string]any{
+								"id":     "9fe1d3",
+								"name":   "demo",
+								"domain": map[string]any{"id": "default", "name": "Default"},
+							},
+							"project": map[string]any{
+								"id":     "0c4e939acacf4376bdcd1129f1a054ad",
+								"name":   "demo",
+								"domain": map[string]any{"id": "default", "name": "Default"},
+							},
+							"catalog": []map[string]any{
+								{
+									"type": "object-store",
+									"name": "swift",
+									"endpoints": []map[string]any{
+										{"interface": "public", "region": "RegionOne", "url": "https://swift.server/v1/AUTH_0c4e939acacf4376bdcd1129f1a054ad"},
+									},
+								},
+							},
+						},
+					}
+					providerClient := &gophercloud.ProviderClient{}
+					if err := providerClient.SetTokenAndAuthResult(token); err != nil {
+						return nil, nil, err
+					}
+					sc := &gophercloud.ServiceClient{
+						ProviderClient: providerClient,
+						ResourceBase:   "https://keystone.server/identity/v3/",
+					}
+					return ac, sc, nil
+				},
+			}),
+		},
 	}
 
 	for name, test := range tests {
@@ -162,17 +326,28 @@ application_credential_secret= glance_secret
 					attributes := map[string]string{
 						"applicationCredentials": test.applicationCredentials,
 					}
+					for k, v := range test.attributes {
+						attributes[k] = v
+					}
 					data, _ := json.Marshal(attributes)
 					return string(data)
 				}(),
-				Secrets:    "{}",
+				Secrets: func() string {
+					if test.secrets == "" {
+						return testSecrets
+					}
+					return test.secrets
+				}(),
 				TargetPath: "/openstack-auth",
 				Permission: "640",
 				// CurrentObjectVersion: []*v1alpha1.ObjectVersion{},
 			}
 
 			wantMountResponse := &v1alpha1.MountResponse{
-				ObjectVersion: []*v1alpha1.ObjectVersion{test.objectVersion},
+				ObjectVersion: []*v1alpha1.ObjectVersion{{
+					Id:      test.objectVersion.GetId(),
+					Version: test.objectVersion.GetVersion() + "-" + testDigest(t, mountRequest),
+				}},
 				Files: []*v1alpha1.File{
 					{
 						Path:     test.filePath,
@@ -191,3 +366,1328 @@ application_credential_secret= glance_secret
 		})
 	}
 }
+
+func TestMountMultipleFiles(t *testing.T) {
+	server := NewServer(MockedProviderClient{
+		MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+			ac := &applicationcredentials.ApplicationCredential{
+				ID:     "abcdef1234",
+				Secret: "random-generated-secret",
+			}
+			sc := &gophercloud.ServiceClient{
+				ResourceBase: "http://localhost:5000/v3/",
+			}
+			return ac, sc, nil
+		},
+	})
+
+	attributes, _ := json.Marshal(map[string]string{
+		"applicationCredentials": `
+- files:
+  - fileName: clouds.yaml
+  - fileName: openrc
+    format: openrc
+    mode: 0600
+  - fileName: id
+    template: "{{ .AuthInfo.ApplicationCredentialID }}"
+`,
+	})
+	mountRequest := &v1alpha1.MountRequest{
+		Attributes: string(attributes),
+		Secrets:    testSecrets,
+		TargetPath: "/openstack-auth",
+		Permission: "640",
+	}
+
+	wantMountResponse := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{{Id: "abcdef1234", Version: defaultVersion + "-" + testDigest(t, mountRequest)}},
+		Files: []*v1alpha1.File{
+			{
+				Path: "clouds.yaml",
+				Contents: []byte(`clouds:
+  secrets-store-csi:
+    auth:
+      application_credential_id: "abcdef1234"
+      application_credential_secret: "random-generated-secret"
+      auth_url: "http://localhost:5000/v3/"
+    auth_type: "v3applicationcredential"
+`),
+			},
+			{
+				Path: "openrc",
+				Mode: 0o600,
+				Contents: []byte(`export OS_AUTH_TYPE='v3applicationcredential'
+export OS_AUTH_URL='http://localhost:5000/v3/'
+export OS_IDENTITY_API_VERSION=3
+export OS_APPLICATION_CREDENTIAL_ID='abcdef1234'
+export OS_APPLICATION_CREDENTIAL_SECRET='random-generated-secret'
+`),
+			},
+			{
+				Path:     "id",
+				Contents: []byte("abcdef1234"),
+			},
+		},
+	}
+
+	gotMountResponse, err := server.Mount(context.TODO(), mountRequest)
+	if err != nil {
+		t.Fatalf("MountRequest failed: %v", err)
+	}
+	if diff := cmp.Diff(wantMountResponse, gotMountResponse, protocmp.Transform()); diff != "" {
+		t.Errorf("Mount() mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMountInvalidObjects(t *testing.T) {
+	tests := map[string]struct {
+		applicationCredentials string
+		wantErr                string
+	}{
+		"files and fileName": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  files:
+  - fileName: openrc
+`,
+			wantErr: "mutually exclusive",
+		},
+		"duplicate fileName": {
+			applicationCredentials: `
+- files:
+  - fileName: clouds.yaml
+  - fileName: clouds.yaml
+    format: json
+`,
+			wantErr: `duplicate fileName "clouds.yaml"`,
+		},
+		"empty fileName": {
+			applicationCredentials: `
+- files:
+  - format: json
+`,
+			wantErr: "fileName should not be empty",
+		},
+		"absolute fileName": {
+			applicationCredentials: `
+- fileName: /etc/clouds.yaml
+`,
+			wantErr: `fileName "/etc/clouds.yaml" should be a relative path within the volume`,
+		},
+		"fileName outside of the volume": {
+			applicationCredentials: `
+- fileName: ../clouds.yaml
+`,
+			wantErr: `fileName "../clouds.yaml" should be a relative path within the volume`,
+		},
+		"fileName not clean": {
+			applicationCredentials: `
+- fileName: config/../../clouds.yaml
+`,
+			wantErr: "should be a relative path within the volume",
+		},
+		"unknown field": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  role: member
+`,
+			wantErr: `unknown field "role"`,
+		},
+		"empty entry": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+-
+`,
+			wantErr: "invalid applicationCredentials[1], error: entry should not be empty",
+		},
+		"too many files": {
+			applicationCredentials: "- files:\n" + strings.Repeat("  - fileName: clouds.yaml\n", MaxObjectFiles+1),
+			wantErr:                "invalid applicationCredentials[0], error: files should not have more than 20 entries",
+		},
+		"too many entries": {
+			applicationCredentials: strings.Repeat("- fileName: clouds.yaml\n", maxApplicationCredentials+1),
+			wantErr:                "should not have more than 100 entries",
+		},
+		"too large": {
+			applicationCredentials: "- fileName: clouds.yaml\n  template: " + strings.Repeat("x", maxApplicationCredentialsSize),
+			wantErr:                "should not exceed",
+		},
+		"access rule without service": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  accessRules:
+  - method: GET
+    path: /v2.1/servers
+`,
+			wantErr: `invalid applicationCredentials[0], error: invalid accessRules[0], error: service "" should be a service type, e.g. object-store`,
+		},
+		"access rule with unknown method": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  accessRules:
+  - service: compute
+    method: get
+    path: /v2.1/servers
+`,
+			wantErr: `invalid accessRules[0], error: method "get" should be one of GET, HEAD, POST, PUT, PATCH, DELETE`,
+		},
+		"access rule with relative path": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  accessRules:
+  - service: compute
+    method: GET
+    path: /v2.1/servers
+  - service: compute
+    method: GET
+    path: v2.1/flavors
+`,
+			wantErr: `invalid accessRules[1], error: path "v2.1/flavors" should be an absolute API path without spaces`,
+		},
+		"access rule with unknown field": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  accessRules:
+  - service: compute
+    method: GET
+    path: /v2.1/servers
+    id: abc
+`,
+			wantErr: `unknown field "id"`,
+		},
+		"template too large": {
+			applicationCredentials: "- fileName: clouds.yaml\n  template: " + strings.Repeat("x", MaxTemplateSize+1),
+			wantErr:                `template of "clouds.yaml" should not exceed 65536 bytes`,
+		},
+		"method with variable argument": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: '{{ $layout := printf "%01000d" 0 }}{{ .ExpiresAt.Format $layout }}'
+`,
+			wantErr: "template: clouds.yaml:1:38: methods should only be given literal arguments, got .ExpiresAt.Format $layout",
+		},
+		"method with piped argument": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: '{{ printf "%01000d" 0 | .ExpiresAt.Format }}'
+`,
+			wantErr: "methods should not be given piped values",
+		},
+		"projectID and projectName": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  projectID: abc
+  projectName: demo
+`,
+			wantErr: "projectID and projectName are mutually exclusive",
+		},
+		"projectName without domain": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  projectName: demo
+`,
+			wantErr: "projectName requires domainID or domainName",
+		},
+		"domain without project": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  domainName: Default
+`,
+			wantErr: "domainID and domainName require projectName",
+		},
+		"invalid mode": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  mode: 01000
+`,
+			wantErr: "mode 01000",
+		},
+		"malformed template": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: "{{ .AuthType "
+`,
+			wantErr: `invalid applicationCredentials[0], error: template: clouds.yaml:1: unclosed action`,
+		},
+		"unknown function": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: "{{ env \"HOME\" }}"
+`,
+			wantErr: `function "env" not defined`,
+		},
+	}
+
+	server := NewServer(MockedProviderClient{
+		MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+			t.Fatal("credential should not be created for invalid objects")
+			return nil, nil, nil
+		},
+	})
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			attributes, _ := json.Marshal(map[string]string{
+				"applicationCredentials": test.applicationCredentials,
+			})
+			_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    testSecrets,
+				TargetPath: "/openstack-auth",
+				Permission: "640",
+			})
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestMountRenderErrors covers templates which parse, but fail to render
+// with the issued credential, which is deleted then
+func TestMountRenderErrors(t *testing.T) {
+	tests := map[string]struct {
+		applicationCredentials string
+		templateTimeout        time.Duration
+		wantErr                string
+	}{
+		"steps of files": {
+			applicationCredentials: `
+- files:
+  - fileName: a
+    template: "{{ range 100000 }}{{ end }}"
+  - fileName: b
+    template: "{{ range 100000 }}{{ end }}"
+  - fileName: c
+    template: "{{ range 100000 }}{{ end }}"
+`,
+			wantErr: `failed to render "c", error: template: c:1:18: executing "c" at <step 32>: error calling step: template execution exceeds 8388608 steps`,
+		},
+		"steps of entries": {
+			applicationCredentials: `
+- fileName: a
+  template: "{{ range 100000 }}{{ end }}"
+- fileName: b
+  template: "{{ range 100000 }}{{ end }}"
+- fileName: c
+  template: "{{ range 100000 }}{{ end }}"
+`,
+			wantErr: "failed to render applicationCredentials[2]",
+		},
+		"template timeout": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: "{{ range 1000 }}{{ end }}"
+`,
+			templateTimeout: time.Nanosecond,
+			wantErr:         "template execution exceeds 1ns",
+		},
+		"output too large": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: "{{ range 2000 }}{{ printf \"%0600d\" 0 }}{{ end }}"
+`,
+			wantErr: "output exceeds 1048576 bytes",
+		},
+		"unbounded loop": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: "{{ range 100000000000 }}{{ end }}"
+`,
+			wantErr: "template execution exceeds 8388608 steps",
+		},
+		"nested loops": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: "{{ range 1000 }}{{ range 1000 }}{{ range 1000 }}{{ end }}{{ end }}{{ end }}"
+`,
+			wantErr: "template execution exceeds 8388608 steps",
+		},
+		"string doubling": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: '{{ $x := "ab" }}{{ range 40 }}{{ $x = printf "%s%s" $x $x }}{{ end }}'
+`,
+			wantErr: "error calling printf: value would exceed 1048576 bytes",
+		},
+		"values too large in total": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  template: '{{ range 100 }}{{ $x := printf "%0900000d" 0 }}{{ end }}'
+`,
+			wantErr: "values of template functions exceed 16777216 bytes in total",
+		},
+		"indent amplification": {
+			applicationCredentials: "- fileName: clouds.yaml\n  template: '{{ indent 1024 \"" + strings.Repeat(`\n`, 2000) + "\" }}'\n",
+			wantErr:                "error calling indent: value would exceed 1048576 bytes",
+		},
+		"unknown field in template": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+- fileName: keystone.conf
+  template: |
+    [keystone_authtoken]
+    auth_url = {{ .AuthInfo.AuthUrl }}
+`,
+			wantErr: `failed to render applicationCredentials[1], error: failed to render "keystone.conf", error: template: keystone.conf:2:23: executing "keystone.conf" at <.AuthInfo.AuthUrl>: can't evaluate field AuthUrl`,
+		},
+		"unknown field in one of files": {
+			applicationCredentials: `
+- files:
+  - fileName: clouds.yaml
+  - fileName: openrc
+    template: "{{ range .Roles }}{{ .Nmae }}{{ end }}"
+`,
+			wantErr: `failed to render applicationCredentials[0], error: failed to render "openrc", error: template: openrc:1:21: executing "openrc" at <.Nmae>: can't evaluate field Nmae`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var created, deleted []string
+			server := NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					ac := &applicationcredentials.ApplicationCredential{
+						ID:    fmt.Sprintf("ac-%d", len(created)),
+						Roles: []applicationcredentials.Role{{ID: "1", Name: "member"}},
+					}
+					created = append(created, ac.ID)
+					return ac, &gophercloud.ServiceClient{}, nil
+				},
+				MockedDeleteApplicationCredential: func(ctx context.Context, identityClient *gophercloud.ServiceClient, id string) error {
+					deleted = append(deleted, id)
+					return nil
+				},
+			}, WithTemplateTimeout(test.templateTimeout))
+
+			attributes, _ := json.Marshal(map[string]string{
+				"applicationCredentials": test.applicationCredentials,
+			})
+			_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    testSecrets,
+				TargetPath: "/openstack-auth",
+				Permission: "640",
+			})
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+			if len(created) == 0 || !slices.Equal(created, deleted) {
+				t.Errorf("expected created credentials %v to be deleted, got %v", created, deleted)
+			}
+		})
+	}
+}
+
+func TestMountCreateOpts(t *testing.T) {
+	tests := map[string]struct {
+		opts            []Option
+		wantName        *regexp.Regexp
+		wantDescription string
+	}{
+		"default name template": {
+			wantName:        regexp.MustCompile(`^secrets-store-csi-[a-z0-9]{16}$`),
+			wantDescription: "Created by secrets-store-csi-driver-provider-openstack namespace=default pod=demo-app-7dc68c4b7f-sjc6l podUID=f64099e3-1962-4078-b995-8f0f2f04b33f serviceAccount=demo-app secretProviderClass=my-openstack",
+		},
+		"custom name template": {
+			opts: []Option{WithNameTemplate(template.Must(NewNameTemplate(
+				"{{ .SecretProviderClass }}-{{ .Pod.Namespace }}-{{ .Pod.Name }}-{{ .Suffix }}",
+			)))},
+			wantName:        regexp.MustCompile(`^my-openstack-default-demo-app-7dc68c4b7f-sjc6l-[a-z0-9]{16}$`),
+			wantDescription: "Created by secrets-store-csi-driver-provider-openstack namespace=default pod=demo-app-7dc68c4b7f-sjc6l podUID=f64099e3-1962-4078-b995-8f0f2f04b33f serviceAccount=demo-app secretProviderClass=my-openstack",
+		},
+		"long name truncated at rune boundary": {
+			opts: []Option{WithNameTemplate(template.Must(NewNameTemplate(
+				strings.Repeat("a", maxNameLength-suffixLength-1) + "é{{ .Suffix }}",
+			)))},
+			wantName:        regexp.MustCompile(`^a{238}[a-z0-9]{16}$`),
+			wantDescription: "Created by secrets-store-csi-driver-provider-openstack namespace=default pod=demo-app-7dc68c4b7f-sjc6l podUID=f64099e3-1962-4078-b995-8f0f2f04b33f serviceAccount=demo-app secretProviderClass=my-openstack",
+		},
+		"long name keeps the suffix": {
+			opts: []Option{WithNameTemplate(template.Must(NewNameTemplate(
+				strings.Repeat("a", 300) + "-{{ .Suffix }}-x",
+			)))},
+			wantName:        regexp.MustCompile(`^a{237}[a-z0-9]{16}-x$`),
+			wantDescription: "Created by secrets-store-csi-driver-provider-openstack namespace=default pod=demo-app-7dc68c4b7f-sjc6l podUID=f64099e3-1962-4078-b995-8f0f2f04b33f serviceAccount=demo-app secretProviderClass=my-openstack",
+		},
+		"long name without suffix": {
+			opts: []Option{WithNameTemplate(template.Must(NewNameTemplate(
+				strings.Repeat("a", 300),
+			)))},
+			wantName:        regexp.MustCompile(`^a{255}$`),
+			wantDescription: "Created by secrets-store-csi-driver-provider-openstack namespace=default pod=demo-app-7dc68c4b7f-sjc6l podUID=f64099e3-1962-4078-b995-8f0f2f04b33f serviceAccount=demo-app secretProviderClass=my-openstack",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var createMap map[string]any
+			server := NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					var err error
+					createMap, err = createOpts.ToApplicationCredentialCreateMap()
+					return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, err
+				},
+			}, test.opts...)
+
+			attributes, _ := json.Marshal(map[string]string{
+				"applicationCredentials":                 "- fileName: clouds.yaml",
+				"csi.storage.k8s.io/pod.name":            "demo-app-7dc68c4b7f-sjc6l",
+				"csi.storage.k8s.io/pod.namespace":       "default",
+				"csi.storage.k8s.io/pod.uid":             "f64099e3-1962-4078-b995-8f0f2f04b33f",
+				"csi.storage.k8s.io/serviceAccount.name": "demo-app",
+				"secretProviderClass":                    "my-openstack",
+			})
+			_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    testSecrets,
+				TargetPath: "/openstack-auth",
+				Permission: "640",
+			})
+			if err != nil {
+				t.Fatalf("MountRequest failed: %v", err)
+			}
+
+			applicationCredential := createMap["application_credential"].(map[string]any)
+			if name := applicationCredential["name"].(string); !test.wantName.MatchString(name) || !utf8.ValidString(name) {
+				t.Errorf("name %q should match %s", name, test.wantName)
+			}
+			if description := applicationCredential["description"]; description != test.wantDescription {
+				t.Errorf("got description %q, want %q", description, test.wantDescription)
+			}
+		})
+	}
+}
+
+func TestNewNameTemplate(t *testing.T) {
+	for _, tmpl := range []string{"{{ .Pod.Nmae }}", "{{ .Suffix ", ""} {
+		if _, err := NewNameTemplate(tmpl); err == nil {
+			t.Errorf("expected error for name template %q", tmpl)
+		}
+	}
+}
+
+func TestMountConcurrentNamesAreUnique(t *testing.T) {
+	var mu sync.Mutex
+	names := map[string]bool{}
+	server := NewServer(MockedProviderClient{
+		MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+			createMap, err := createOpts.ToApplicationCredentialCreateMap()
+			if err != nil {
+				return nil, nil, err
+			}
+			name := createMap["application_credential"].(map[string]any)["name"].(string)
+			mu.Lock()
+			defer mu.Unlock()
+			if names[name] {
+				return nil, nil, fmt.Errorf("duplicate name %s", name)
+			}
+			names[name] = true
+			return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, nil
+		},
+	}, WithNameTemplate(template.Must(NewNameTemplate("secrets-store-csi-{{ .Suffix }}"))))
+
+	attributes, _ := json.Marshal(map[string]string{
+		"applicationCredentials": "- fileName: clouds.yaml",
+	})
+	var wg sync.WaitGroup
+	for range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    testSecrets,
+				TargetPath: "/openstack-auth",
+				Permission: "640",
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMountPolicy(t *testing.T) {
+	p, err := policy.Parse([]byte(`
+version: v1
+rules:
+- namespaces: ["default"]
+  serviceAccounts: ["demo-app"]
+  allowedRoles: ["member"]
+  maxExpiresIn: 24h
+  allowedRegions: ["RegionOne"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		applicationCredentials string
+		serviceAccount         string
+		defaultExpiresIn       time.Duration
+		wantErr                string
+		wantRoles              []any
+		wantExpiresIn          time.Duration
+	}{
+		"allowed": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+  expiresIn: 12h
+`,
+			serviceAccount: "demo-app",
+			wantRoles:      []any{map[string]any{"name": "member"}},
+			wantExpiresIn:  12 * time.Hour,
+		},
+		"other service account": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+`,
+			serviceAccount: "default",
+			wantErr:        `applicationCredentials[0] denied by policy, error: no policy rule allows namespace "default" and service account "default"`,
+		},
+		"role not allowed": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+- fileName: admin.yaml
+  roles: [admin]
+`,
+			serviceAccount: "demo-app",
+			wantErr:        `applicationCredentials[1] denied by policy, error: role "admin" is not allowed`,
+		},
+		"default expiry": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+`,
+			serviceAccount: "demo-app",
+			wantRoles:      []any{map[string]any{"name": "member"}},
+			wantExpiresIn:  DefaultExpiresIn,
+		},
+		"server default expiry": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+`,
+			serviceAccount:   "demo-app",
+			defaultExpiresIn: 12 * time.Hour,
+			wantRoles:        []any{map[string]any{"name": "member"}},
+			wantExpiresIn:    12 * time.Hour,
+		},
+		"server default expiry exceeded": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+`,
+			serviceAccount:   "demo-app",
+			defaultExpiresIn: 48 * time.Hour,
+			wantErr:          "applicationCredentials[0] denied by policy, error: expiresIn 48h0m0s exceeds maximum of 24h0m0s",
+		},
+		"project of the Secret credentials": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+  projectID: other-project
+`,
+			serviceAccount: "demo-app",
+			wantRoles:      []any{map[string]any{"name": "member"}},
+			wantExpiresIn:  DefaultExpiresIn,
+		},
+		"region not allowed": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+  region: RegionTwo
+`,
+			serviceAccount: "demo-app",
+			wantErr:        `applicationCredentials[0] denied by policy, error: region "RegionTwo" is not allowed`,
+		},
+		"expiry exceeded": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  roles: [member]
+  expiresIn: 48h
+`,
+			serviceAccount: "demo-app",
+			wantErr:        "applicationCredentials[0] denied by policy, error: expiresIn 48h0m0s exceeds maximum of 24h0m0s",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var createMap map[string]any
+			server := NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					if test.wantErr != "" {
+						t.Fatal("credential should not be created when denied by policy")
+					}
+					var err error
+					createMap, err = createOpts.ToApplicationCredentialCreateMap()
+					return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, err
+				},
+			}, WithPolicy(policy.NewStore(p)), WithDefaultExpiresIn(test.defaultExpiresIn))
+
+			attributes, _ := json.Marshal(map[string]string{
+				"applicationCredentials":                 test.applicationCredentials,
+				"csi.storage.k8s.io/pod.namespace":       "default",
+				"csi.storage.k8s.io/serviceAccount.name": test.serviceAccount,
+			})
+			_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    testSecrets,
+				TargetPath: "/openstack-auth",
+				Permission: "640",
+			})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MountRequest failed: %v", err)
+			}
+
+			applicationCredential := createMap["application_credential"].(map[string]any)
+			if diff := cmp.Diff(test.wantRoles, applicationCredential["roles"]); diff != "" {
+				t.Errorf("roles mismatch (-want, +got):\n%s", diff)
+			}
+			expiresAt, err := time.Parse(gophercloud.RFC3339MilliNoZ, applicationCredential["expires_at"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expiresIn := time.Until(expiresAt); expiresIn > test.wantExpiresIn || expiresIn < test.wantExpiresIn-time.Minute {
+				t.Errorf("credential expires in %s, want %s", expiresIn, test.wantExpiresIn)
+			}
+		})
+	}
+}
+
+type staticCredentials map[string]string
+
+func (c staticCredentials) Credentials() (map[string]string, error) {
+	return c, nil
+}
+
+func TestMountDefaultCredentials(t *testing.T) {
+	p, err := policy.Parse([]byte(`
+version: v1
+rules:
+- namespaces: ["trusted"]
+  allowDefaultCredentials: true
+  allowedTrustIDs: ["trust-a*"]
+  allowedProjects: ["team-a-*"]
+- namespaces: ["shared"]
+  allowDefaultCredentials: true
+- namespaces: ["*"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultCredentials := staticCredentials{"OS_AUTH_URL": "http://default:5000/v3/", "OS_REGION_NAME": "RegionTwo"}
+
+	tests := map[string]struct {
+		secrets string
+		// namespace defaults to trusted if wantAuth is set, untrusted
+		// otherwise
+		namespace              string
+		applicationCredentials string
+		opts                   []Option
+		wantAuth               map[string]string
+		wantErr                string
+	}{
+		"no secrets and no default credentials": {
+			secrets: "{}",
+			opts:    []Option{WithPolicy(policy.NewStore(p))},
+			wantErr: "secrets should be provided via volume.csi.nodePublishSecretRef.name",
+		},
+		"default credentials without policy": {
+			secrets: "{}",
+			opts:    []Option{WithDefaultCredentials(defaultCredentials)},
+			wantErr: "default credentials require a policy",
+		},
+		"default credentials not allowed": {
+			secrets: "null",
+			opts:    []Option{WithDefaultCredentials(defaultCredentials), WithPolicy(policy.NewStore(p))},
+			wantErr: "default credentials are not allowed",
+		},
+		"default credentials allowed": {
+			secrets:  "",
+			opts:     []Option{WithDefaultCredentials(defaultCredentials), WithPolicy(policy.NewStore(p))},
+			wantAuth: defaultCredentials,
+		},
+		"trust with default credentials": {
+			secrets:  `{"OS_TRUST_ID": "trust-abc"}`,
+			opts:     []Option{WithDefaultCredentials(defaultCredentials), WithPolicy(policy.NewStore(p))},
+			wantAuth: map[string]string{"OS_AUTH_URL": "http://default:5000/v3/", "OS_REGION_NAME": "RegionTwo", "OS_TRUST_ID": "trust-abc"},
+		},
+		"trust not allowed": {
+			secrets: `{"OS_TRUST_ID": "trust-xyz"}`,
+			opts:    []Option{WithDefaultCredentials(defaultCredentials), WithPolicy(policy.NewStore(p))},
+			wantErr: `trust "trust-xyz" is not allowed`,
+		},
+		"allowed project with default credentials": {
+			applicationCredentials: "- fileName: clouds.yaml\n  projectName: team-a-prod\n  domainName: Default",
+			opts:                   []Option{WithDefaultCredentials(defaultCredentials), WithPolicy(policy.NewStore(p))},
+			wantAuth:               defaultCredentials,
+		},
+		"other project with default credentials": {
+			namespace:              "trusted",
+			applicationCredentials: "- fileName: clouds.yaml\n  projectID: team-b-prod-id",
+			opts:                   []Option{WithDefaultCredentials(defaultCredentials), WithPolicy(policy.NewStore(p))},
+			wantErr:                `project "team-b-prod-id" is not allowed`,
+		},
+		"project with default credentials without allowed projects": {
+			namespace:              "shared",
+			applicationCredentials: "- fileName: clouds.yaml\n  projectID: team-a-prod-id",
+			opts:                   []Option{WithDefaultCredentials(defaultCredentials), WithPolicy(policy.NewStore(p))},
+			wantErr:                `project "team-a-prod-id" is not allowed`,
+		},
+		"nodePublishSecretRef takes precedence": {
+			secrets:  testSecrets,
+			opts:     []Option{WithDefaultCredentials(defaultCredentials), WithPolicy(policy.NewStore(p))},
+			wantAuth: map[string]string{"OS_AUTH_URL": "http://localhost:5000/v3/"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					if diff := cmp.Diff(test.wantAuth, auth); diff != "" {
+						t.Errorf("auth mismatch (-want, +got):\n%s", diff)
+					}
+					return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, nil
+				},
+			}, test.opts...)
+
+			namespace := test.namespace
+			if namespace == "" {
+				namespace = "untrusted"
+				if test.wantAuth != nil || strings.Contains(test.secrets, "OS_TRUST_ID") {
+					namespace = "trusted"
+				}
+			}
+			applicationCredentials := test.applicationCredentials
+			if applicationCredentials == "" {
+				applicationCredentials = "- fileName: clouds.yaml"
+			}
+			attributes, _ := json.Marshal(map[string]string{
+				"applicationCredentials":           applicationCredentials,
+				"csi.storage.k8s.io/pod.namespace": namespace,
+			})
+			_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    test.secrets,
+				TargetPath: "/openstack-auth",
+				Permission: "640",
+			})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MountRequest failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestMountScope(t *testing.T) {
+	var scopes []*gophercloud.AuthScope
+	server := NewServer(MockedProviderClient{
+		MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+			scopes = append(scopes, scope)
+			return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, nil
+		},
+	})
+
+	attributes, _ := json.Marshal(map[string]string{
+		"applicationCredentials": `
+- fileName: default.yaml
+- fileName: by-id.yaml
+  projectID: 0c4e939acacf4376bdcd1129f1a054ad
+- fileName: by-name.yaml
+  projectName: demo
+  domainName: Default
+`,
+	})
+	_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+		Attributes: string(attributes),
+		Secrets:    testSecrets,
+		TargetPath: "/openstack-auth",
+		Permission: "640",
+	})
+	if err != nil {
+		t.Fatalf("MountRequest failed: %v", err)
+	}
+
+	want := []*gophercloud.AuthScope{
+		nil,
+		{ProjectID: "0c4e939acacf4376bdcd1129f1a054ad"},
+		{ProjectName: "demo", DomainName: "Default"},
+	}
+	if diff := cmp.Diff(want, scopes); diff != "" {
+		t.Errorf("scopes mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMountClouds(t *testing.T) {
+	cloudsYAML := `
+clouds:
+  east:
+    auth:
+      auth_url: http://east:5000/v3/
+      application_credential_id: east-id
+      application_credential_secret: east-secret
+    region_name: RegionOne
+  west:
+    auth:
+      auth_url: http://west:5000/v3/
+      application_credential_id: west-id
+      application_credential_secret: west-secret
+`
+	tests := map[string]struct {
+		applicationCredentials string
+		secrets                map[string]string
+		// OS_AUTH_URL and OS_REGION_NAME per object
+		want    [][2]string
+		wantErr string
+	}{
+		"cloud per object": {
+			applicationCredentials: `
+- fileName: east.yaml
+  cloud: east
+- fileName: west.yaml
+  cloud: west
+- fileName: west-2.yaml
+  cloud: west
+  region: RegionTwo
+`,
+			secrets: map[string]string{CloudsYAMLKey: cloudsYAML},
+			want: [][2]string{
+				{"http://east:5000/v3/", "RegionOne"},
+				{"http://west:5000/v3/", ""},
+				{"http://west:5000/v3/", "RegionTwo"},
+			},
+		},
+		"OS_CLOUD is the default": {
+			applicationCredentials: `
+- fileName: west.yaml
+- fileName: east.yaml
+  cloud: east
+`,
+			secrets: map[string]string{CloudsYAMLKey: cloudsYAML, "OS_CLOUD": "west"},
+			want: [][2]string{
+				{"http://west:5000/v3/", ""},
+				{"http://east:5000/v3/", "RegionOne"},
+			},
+		},
+		"region without clouds.yaml": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  region: RegionTwo
+`,
+			secrets: map[string]string{"OS_AUTH_URL": "http://localhost:5000/v3/"},
+			want: [][2]string{
+				{"http://localhost:5000/v3/", "RegionTwo"},
+			},
+		},
+		"cloud is required": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+`,
+			secrets: map[string]string{CloudsYAMLKey: cloudsYAML},
+			wantErr: "cloud should be set, clouds.yaml defines east, west",
+		},
+		"unknown cloud": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  cloud: north
+`,
+			secrets: map[string]string{CloudsYAMLKey: cloudsYAML},
+			wantErr: `cloud "north" not found in clouds.yaml`,
+		},
+		"cloud without clouds.yaml": {
+			applicationCredentials: `
+- fileName: clouds.yaml
+  cloud: east
+`,
+			secrets: map[string]string{"OS_AUTH_URL": "http://localhost:5000/v3/"},
+			wantErr: `cloud "east" requires clouds.yaml in the Secret`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got [][2]string
+			server := NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					got = append(got, [2]string{auth["OS_AUTH_URL"], auth["OS_REGION_NAME"]})
+					return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, nil
+				},
+			})
+
+			attributes, _ := json.Marshal(map[string]string{"applicationCredentials": tc.applicationCredentials})
+			secrets, _ := json.Marshal(tc.secrets)
+			_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    string(secrets),
+				TargetPath: "/openstack-auth",
+				Permission: "640",
+			})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				if got != nil {
+					t.Error("no application credentials should be created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MountRequest failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("credentials mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMountResponseSizeLimit(t *testing.T) {
+	server := NewServer(MockedProviderClient{
+		MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+			return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, nil
+		},
+	})
+
+	// every file is within MaxFileSize, but all of them are not
+	var applicationCredentials strings.Builder
+	for i := range MaxMountResponseSize/MaxFileSize + 1 {
+		fmt.Fprintf(&applicationCredentials, "- fileName: file-%d\n  template: '{{ range 1000 }}{{ printf \"%%01000d\" 0 }}{{ end }}'\n", i)
+	}
+	attributes, _ := json.Marshal(map[string]string{"applicationCredentials": applicationCredentials.String()})
+	_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+		Attributes: string(attributes),
+		Secrets:    testSecrets,
+		TargetPath: "/openstack-auth",
+		Permission: "640",
+	})
+	if err == nil || !strings.Contains(err.Error(), "files of applicationCredentials exceed 3145728 bytes") {
+		t.Fatalf("expected size limit error, got %v", err)
+	}
+}
+
+func TestMountContextErrors(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		wantCode codes.Code
+	}{
+		"deadline exceeded": {
+			err:      fmt.Errorf("post failed, error: %w", context.DeadlineExceeded),
+			wantCode: codes.DeadlineExceeded,
+		},
+		"canceled": {
+			err:      fmt.Errorf("post failed, error: %w", context.Canceled),
+			wantCode: codes.Canceled,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			server := NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					calls++
+					if calls == 2 {
+						return nil, nil, tc.err
+					}
+					return &applicationcredentials.ApplicationCredential{}, &gophercloud.ServiceClient{}, nil
+				},
+			})
+
+			attributes, _ := json.Marshal(map[string]string{"applicationCredentials": "- fileName: a.yaml\n- fileName: b.yaml\n"})
+			_, err := server.Mount(context.TODO(), &v1alpha1.MountRequest{
+				Attributes: string(attributes),
+				Secrets:    testSecrets,
+				TargetPath: "/openstack-auth",
+				Permission: "640",
+			})
+			if status.Code(err) != tc.wantCode || !strings.Contains(err.Error(), "applicationCredentials[1]") {
+				t.Fatalf("expected %s for applicationCredentials[1], got %v", tc.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestMountRotation(t *testing.T) {
+	now := time.Now()
+	mountRequest := func(applicationCredentials, secrets string, current []*v1alpha1.ObjectVersion) *v1alpha1.MountRequest {
+		attributes, _ := json.Marshal(map[string]string{"applicationCredentials": applicationCredentials})
+		return &v1alpha1.MountRequest{
+			Attributes:           string(attributes),
+			Secrets:              secrets,
+			TargetPath:           "/openstack-auth",
+			Permission:           "640",
+			CurrentObjectVersion: current,
+		}
+	}
+	// the mounted credential of an entry rendering clouds.yaml
+	digest := testDigest(t, mountRequest("- fileName: clouds.yaml\n", testSecrets, nil))
+	version := func(fingerprint string, expiresIn time.Duration) string {
+		return credentialVersion{Fingerprint: fingerprint, IssuedAt: now.Add(expiresIn - time.Hour), ExpiresAt: now.Add(expiresIn), Digest: digest}.String()
+	}
+	tests := map[string]struct {
+		applicationCredentials string
+		secrets                string
+		current                []*v1alpha1.ObjectVersion
+		renewBefore            time.Duration
+		wantRenewed            bool
+	}{
+		"initial mount": {
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"valid credential": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: version(defaultVersion, 50*time.Minute)}},
+			renewBefore: 15 * time.Minute,
+		},
+		"credential never expiring": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: credentialVersion{Fingerprint: defaultVersion, Digest: digest}.String()}},
+			renewBefore: 15 * time.Minute,
+		},
+		"credential expiring within renewBefore": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: version(defaultVersion, 10*time.Minute)}},
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"expired credential": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: version(defaultVersion, -time.Minute)}},
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"changed request": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: version(ApplicationCredentialObject{Roles: []string{"reader"}}.Fingerprint(), 50*time.Minute)}},
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"changed template": {
+			applicationCredentials: "- fileName: clouds.yaml\n  template: '{{ .AuthInfo.ApplicationCredentialID }}'\n",
+			current:                []*v1alpha1.ObjectVersion{{Id: "current", Version: version(defaultVersion, 50*time.Minute)}},
+			renewBefore:            15 * time.Minute,
+			wantRenewed:            true,
+		},
+		"added file": {
+			applicationCredentials: "- files:\n  - fileName: clouds.yaml\n  - fileName: openrc\n    format: openrc\n",
+			current:                []*v1alpha1.ObjectVersion{{Id: "current", Version: version(defaultVersion, 50*time.Minute)}},
+			renewBefore:            15 * time.Minute,
+			wantRenewed:            true,
+		},
+		"changed identity of the Secret": {
+			secrets:     `{"OS_AUTH_URL": "http://localhost:5000/v3/", "OS_USERNAME": "other"}`,
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: version(defaultVersion, 50*time.Minute)}},
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"changed password of the Secret": {
+			secrets:     `{"OS_AUTH_URL": "http://localhost:5000/v3/", "OS_PASSWORD": "rotated"}`,
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: version(defaultVersion, 50*time.Minute)}},
+			renewBefore: 15 * time.Minute,
+		},
+		"version of earlier releases": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: "v1"}},
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"version without digest": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: fmt.Sprintf("%s-%d-%d", defaultVersion, now.Unix(), now.Add(50*time.Minute).Unix())}},
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"malformed version": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: defaultVersion + "-soon-later-" + digest}},
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"removed object": {
+			current: []*v1alpha1.ObjectVersion{
+				{Id: "current", Version: version(defaultVersion, 50*time.Minute)},
+				{Id: "removed", Version: version(defaultVersion, 50*time.Minute)},
+			},
+			renewBefore: 15 * time.Minute,
+			wantRenewed: true,
+		},
+		"renewal on every poll": {
+			current:     []*v1alpha1.ObjectVersion{{Id: "current", Version: version(defaultVersion, 50*time.Minute)}},
+			wantRenewed: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			server := NewServer(MockedProviderClient{
+				MockedCreateApplicationCredential: func(ctx context.Context, auth map[string]string, scope *gophercloud.AuthScope, createOpts applicationcredentials.CreateOptsBuilder) (*applicationcredentials.ApplicationCredential, *gophercloud.ServiceClient, error) {
+					calls++
+					return &applicationcredentials.ApplicationCredential{ID: "renewed", ExpiresAt: now.Add(time.Hour)}, &gophercloud.ServiceClient{}, nil
+				},
+			}, WithRenewBefore(tc.renewBefore))
+
+			applicationCredentials, secrets := tc.applicationCredentials, tc.secrets
+			if applicationCredentials == "" {
+				applicationCredentials = "- fileName: clouds.yaml\n"
+			}
+			if secrets == "" {
+				secrets = testSecrets
+			}
+			req := mountRequest(applicationCredentials, secrets, tc.current)
+			response, err := server.Mount(context.TODO(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := &v1alpha1.MountResponse{ObjectVersion: tc.current}
+			if tc.wantRenewed {
+				want.ObjectVersion = []*v1alpha1.ObjectVersion{{
+					Id:      "renewed",
+					Version: credentialVersion{Fingerprint: defaultVersion, IssuedAt: now, ExpiresAt: now.Add(time.Hour), Digest: testDigest(t, req)}.String(),
+				}}
+				if calls != 1 || len(response.GetFiles()) == 0 {
+					t.Errorf("expected a renewed credential and its files, got %d calls and %d files", calls, len(response.GetFiles()))
+				}
+			} else if calls != 0 || len(response.GetFiles()) != 0 {
+				t.Errorf("expected the current credential to be kept, got %d calls and %d files", calls, len(response.GetFiles()))
+			}
+			if diff := cmp.Diff(want.ObjectVersion, response.GetObjectVersion(), protocmp.Transform()); diff != "" {
+				t.Errorf("object versions mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := ApplicationCredentialObject{
+		ObjectFile: ObjectFile{FileName: "clouds.yaml"},
+		Roles:      []string{"member"},
+		AccessRules: []AccessRule{
+			{Service: "object-store", Method: "GET", Path: "/v1/*/backups/**"},
+		},
+	}
+
+	tests := map[string]struct {
+		object      func(o *ApplicationCredentialObject)
+		wantChanged bool
+	}{
+		"unchanged": {
+			object: func(o *ApplicationCredentialObject) {},
+		},
+		"files": {
+			object: func(o *ApplicationCredentialObject) {
+				o.ObjectFile = ObjectFile{}
+				format := "openrc"
+				o.Files = []ObjectFile{{FileName: "openrc", Format: &format}}
+			},
+		},
+		"default expiry set explicitly": {
+			object: func(o *ApplicationCredentialObject) { o.ExpiresIn = &Duration{DefaultExpiresIn} },
+		},
+		"access rule path": {
+			object:      func(o *ApplicationCredentialObject) { o.AccessRules[0].Path = "/v1/*/backups" },
+			wantChanged: true,
+		},
+		"access rule added": {
+			object: func(o *ApplicationCredentialObject) {
+				o.AccessRules = append(o.AccessRules, AccessRule{Service: "object-store", Method: "PUT", Path: "/v1/*/backups/**"})
+			},
+			wantChanged: true,
+		},
+		"roles": {
+			object:      func(o *ApplicationCredentialObject) { o.Roles = []string{"reader"} },
+			wantChanged: true,
+		},
+		"expiry": {
+			object:      func(o *ApplicationCredentialObject) { o.ExpiresIn = &Duration{2 * time.Hour} },
+			wantChanged: true,
+		},
+		"scope": {
+			object:      func(o *ApplicationCredentialObject) { o.ProjectID = "other" },
+			wantChanged: true,
+		},
+		"cloud": {
+			object:      func(o *ApplicationCredentialObject) { o.Cloud = "east" },
+			wantChanged: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			object := base
+			object.AccessRules = slices.Clone(base.AccessRules)
+			test.object(&object)
+			if changed := object.Fingerprint() != base.Fingerprint(); changed != test.wantChanged {
+				t.Errorf("fingerprint changed: %t, want %t", changed, test.wantChanged)
+			}
+		})
+	}
+}
+
+func TestVersionDigest(t *testing.T) {
+	base := ApplicationCredentialObject{ObjectFile: ObjectFile{FileName: "clouds.yaml"}}
+	baseAuth := map[string]string{"OS_AUTH_URL": "http://localhost:5000/v3/", "OS_USERNAME": "demo", "OS_PASSWORD": "secret"}
+
+	tests := map[string]struct {
+		object      func(o *ApplicationCredentialObject)
+		auth        func(auth map[string]string)
+		wantChanged bool
+	}{
+		"unchanged": {},
+		"roles": {
+			object: func(o *ApplicationCredentialObject) { o.Roles = []string{"reader"} },
+		},
+		"mode": {
+			object: func(o *ApplicationCredentialObject) {
+				mode := int32(0o600)
+				o.Mode = &mode
+			},
+			wantChanged: true,
+		},
+		"format": {
+			object: func(o *ApplicationCredentialObject) {
+				format := "openrc"
+				o.Format = &format
+			},
+			wantChanged: true,
+		},
+		"project": {
+			auth:        func(auth map[string]string) { auth["OS_PROJECT_NAME"] = "other" },
+			wantChanged: true,
+		},
+		"password": {
+			auth: func(auth map[string]string) { auth["OS_PASSWORD"] = "rotated" },
+		},
+		"token": {
+			auth: func(auth map[string]string) { auth["OS_TOKEN"] = "gAAAAA" },
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			object, auth := base, maps.Clone(baseAuth)
+			if test.object != nil {
+				test.object(&object)
+			}
+			if test.auth != nil {
+				test.auth(auth)
+			}
+			if changed := versionDigest(&object, auth) != versionDigest(&base, baseAuth); changed != test.wantChanged {
+				t.Errorf("digest changed: %t, want %t", changed, test.wantChanged)
+			}
+		})
+	}
+}
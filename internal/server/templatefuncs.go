@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// templateFuncs is the set of functions available to templates in addition to
+// the text/template builtins. Names and semantics follow the Sprig functions
+// of the same name, as commonly used in Helm charts. The set is deliberately
+// small and contains no functions touching the environment, filesystem or
+// network.
+var templateFuncs = template.FuncMap{
+	"quote":   quote,
+	"squote":  squote,
+	"shquote": shquote,
+	"toJson":  toJSON,
+	"toYaml":  toYAML,
+	"b64enc":  b64enc,
+	"b64dec":  b64dec,
+	"indent":  indent,
+	"nindent": nindent,
+	"default": defaultValue,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"date":    date,
+}
+
+// quote wraps the value in double quotes, escaping as needed
+func quote(v any) string {
+	return strconv.Quote(toString(v))
+}
+
+// squote wraps the value in single quotes without any escaping
+func squote(v any) string {
+	return "'" + toString(v) + "'"
+}
+
+// shquote wraps the value in single quotes, escaping as needed for POSIX shells
+func shquote(v any) string {
+	return "'" + strings.ReplaceAll(toString(v), "'", `'\''`) + "'"
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// toYAML returns the YAML representation of the value without the trailing
+// newline, so it could be combined with indent/nindent
+func toYAML(v any) (string, error) {
+	data, err := yaml.Marshal(v)
+	return strings.TrimSuffix(string(data), "\n"), err
+}
+
+func b64enc(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func b64dec(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	return string(data), err
+}
+
+// maxIndent bounds indent, so a template can not allocate arbitrary amounts
+// of memory with a single call
+const maxIndent = 1024
+
+// indent prefixes every line of s with the number of spaces
+func indent(spaces int, s string) (string, error) {
+	if spaces < 0 || spaces > maxIndent {
+		return "", fmt.Errorf("indent should be between 0 and %d, got %d", maxIndent, spaces)
+	}
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad), nil
+}
+
+// nindent is indent preceded by a newline
+func nindent(spaces int, s string) (string, error) {
+	s, err := indent(spaces, s)
+	return "\n" + s, err
+}
+
+// defaultValue returns d if v is empty, i.e. nil or the zero value of its
+// type, or an empty slice or map
+func defaultValue(d any, v any) any {
+	if isEmpty(v) {
+		return d
+	}
+	return v
+}
+
+// date formats t using Go reference time layout
+func date(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+func isEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func executeTestTemplate(t *testing.T, tmpl string, data any) (string, error) {
+	t.Helper()
+	parsed, err := template.New("test").Funcs(templateFuncs).Parse(tmpl)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", tmpl, err)
+	}
+	var buf bytes.Buffer
+	err = parsed.Execute(&buf, data)
+	return buf.String(), err
+}
+
+type templateFuncTest struct {
+	template string
+	data     any
+	want     string
+	wantErr  bool
+}
+
+func runTemplateFuncTests(t *testing.T, tests map[string]templateFuncTest) {
+	t.Helper()
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := executeTestTemplate(t, test.template, test.data)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncQuote(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string":  {template: `{{ quote . }}`, data: `a"b`, want: `"a\"b"`},
+		"pipe":    {template: `{{ . | quote }}`, data: "abc", want: `"abc"`},
+		"number":  {template: `{{ quote . }}`, data: 42, want: `"42"`},
+		"nil":     {template: `{{ quote .X }}`, data: map[string]any{"X": nil}, want: `""`},
+		"newline": {template: `{{ quote . }}`, data: "a\nb", want: `"a\nb"`},
+	})
+}
+
+func TestTemplateFuncSquote(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string": {template: `{{ squote . }}`, data: "abc", want: `'abc'`},
+		"number": {template: `{{ squote . }}`, data: 42, want: `'42'`},
+	})
+}
+
+func TestTemplateFuncShquote(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string":       {template: `{{ shquote . }}`, data: "a b$c", want: `'a b$c'`},
+		"single quote": {template: `{{ shquote . }}`, data: "it's", want: `'it'\''s'`},
+	})
+}
+
+func TestTemplateFuncToJson(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string": {template: `{{ toJson . }}`, data: "a\"b<", want: `"a\"b\u003c"`},
+		"map":    {template: `{{ toJson . }}`, data: map[string]any{"b": 1, "a": []string{"x"}}, want: `{"a":["x"],"b":1}`},
+		"struct": {template: `{{ toJson . }}`, data: Role{ID: "1", Name: "member"}, want: `{"ID":"1","Name":"member","DomainID":""}`},
+		"error":  {template: `{{ toJson . }}`, data: func() {}, wantErr: true},
+	})
+}
+
+func TestTemplateFuncToYaml(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"map":    {template: `{{ toYaml . }}`, data: map[string]any{"b": 1, "a": []string{"x"}}, want: "a:\n- x\nb: 1"},
+		"string": {template: `{{ toYaml . }}`, data: "yes", want: `"yes"`},
+	})
+}
+
+func TestTemplateFuncB64enc(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string": {template: `{{ b64enc . }}`, data: "secret", want: "c2VjcmV0"},
+		"empty":  {template: `{{ b64enc . }}`, data: "", want: ""},
+	})
+}
+
+func TestTemplateFuncB64dec(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string":  {template: `{{ b64dec . }}`, data: "c2VjcmV0", want: "secret"},
+		"invalid": {template: `{{ b64dec . }}`, data: "%%%", wantErr: true},
+	})
+}
+
+func TestTemplateFuncIndent(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"single line": {template: `{{ indent 2 . }}`, data: "a", want: "  a"},
+		"multi line":  {template: `{{ indent 4 . }}`, data: "a\nb", want: "    a\n    b"},
+		"zero":        {template: `{{ indent 0 . }}`, data: "a\nb", want: "a\nb"},
+		"negative":    {template: `{{ indent -1 . }}`, data: "a", wantErr: true},
+		"too large":   {template: `{{ indent 1000000000 . }}`, data: "a", wantErr: true},
+	})
+}
+
+func TestTemplateFuncNindent(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"multi line": {template: `key:{{ nindent 2 . }}`, data: "a: 1\nb: 2", want: "key:\n  a: 1\n  b: 2"},
+		"yaml":       {template: `key:{{ toYaml . | nindent 2 }}`, data: map[string]int{"a": 1}, want: "key:\n  a: 1"},
+	})
+}
+
+func TestTemplateFuncDefault(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"empty string":     {template: `{{ .X | default "fallback" }}`, data: map[string]any{"X": ""}, want: "fallback"},
+		"non empty string": {template: `{{ .X | default "fallback" }}`, data: map[string]any{"X": "value"}, want: "value"},
+		"nil":              {template: `{{ .X | default "fallback" }}`, data: map[string]any{"X": nil}, want: "fallback"},
+		"zero int":         {template: `{{ .X | default 5 }}`, data: map[string]any{"X": 0}, want: "5"},
+		"empty slice":      {template: `{{ .X | default "none" }}`, data: map[string]any{"X": []string{}}, want: "none"},
+		"zero time":        {template: `{{ .X | default "never" }}`, data: map[string]any{"X": time.Time{}}, want: "never"},
+		"struct field":     {template: `{{ .RegionName | default "RegionOne" }}`, data: Cloud{}, want: "RegionOne"},
+	})
+}
+
+func TestTemplateFuncUpper(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string": {template: `{{ upper . }}`, data: "RegionOne", want: "REGIONONE"},
+	})
+}
+
+func TestTemplateFuncLower(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string": {template: `{{ lower . }}`, data: "RegionOne", want: "regionone"},
+	})
+}
+
+func TestTemplateFuncTrim(t *testing.T) {
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"string": {template: `{{ trim . }}`, data: " \tvalue\n ", want: "value"},
+	})
+}
+
+func TestTemplateFuncDate(t *testing.T) {
+	expiresAt := time.Date(2025, 3, 19, 12, 30, 0, 0, time.UTC)
+	runTemplateFuncTests(t, map[string]templateFuncTest{
+		"layout": {template: `{{ date "2006-01-02" . }}`, data: expiresAt, want: "2025-03-19"},
+		"pipe":   {template: `{{ .ExpiresAt | date "2006-01-02T15:04:05Z07:00" }}`, data: Cloud{ExpiresAt: expiresAt}, want: "2025-03-19T12:30:00Z"},
+		"string": {template: `{{ date "2006" . }}`, data: "2025", wantErr: true},
+	})
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// DefaultRenewBefore is how long before expiry the --renew-before default
+// renews credentials
+const DefaultRenewBefore = 15 * time.Minute
+
+// credentialVersion is the ObjectVersion.Version of a mounted credential,
+// <fingerprint>-<issued at>-<expires at>-<digest> with Unix seconds, or
+// <fingerprint>-<digest> if the credential never expires. The driver passes
+// it back as CurrentObjectVersion on rotation polls.
+type credentialVersion struct {
+	Fingerprint string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+	// Digest identifies the files rendered from the credential and the
+	// identity creating it, see versionDigest
+	Digest string
+}
+
+func (v credentialVersion) String() string {
+	if v.ExpiresAt.IsZero() {
+		return fmt.Sprintf("%s-%s", v.Fingerprint, v.Digest)
+	}
+	return fmt.Sprintf("%s-%d-%d-%s", v.Fingerprint, v.IssuedAt.Unix(), v.ExpiresAt.Unix(), v.Digest)
+}
+
+// parseCredentialVersion parses a credentialVersion, reporting false for
+// versions of other formats, e.g. of earlier releases
+func parseCredentialVersion(s string) (credentialVersion, bool) {
+	parts := strings.Split(s, "-")
+	switch len(parts) {
+	case 2:
+		return credentialVersion{Fingerprint: parts[0], Digest: parts[1]}, parts[0] != "" && parts[1] != ""
+	case 4:
+		issuedAt, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return credentialVersion{}, false
+		}
+		expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return credentialVersion{}, false
+		}
+		return credentialVersion{Fingerprint: parts[0], IssuedAt: time.Unix(issuedAt, 0), ExpiresAt: time.Unix(expiresAt, 0), Digest: parts[3]}, true
+	}
+	return credentialVersion{}, false
+}
+
+// secretAuthKeys are auth keys holding secrets rather than identifying the
+// user, left out of versionDigest not to expose hashes of them
+var secretAuthKeys = []string{"OS_PASSWORD", "OS_PASSCODE", "OS_TOKEN", "OS_APPLICATION_CREDENTIAL_SECRET"}
+
+// versionDigest identifies what the mounted files of the object depend on
+// beyond the requested credential: the files with their templates, formats
+// and modes, and the identity auth authenticates as, e.g. the user, project
+// and auth URL of the Secret.
+func versionDigest(object *ApplicationCredentialObject, auth map[string]string) string {
+	identity := maps.Clone(auth)
+	for _, key := range secretAuthKeys {
+		delete(identity, key)
+	}
+	data, err := json.Marshal(struct {
+		Files []ObjectFile
+		Auth  map[string]string
+	}{object.OutputFiles(), identity})
+	if err != nil {
+		// all fields are plain data
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// newCredentialVersion returns the version of the credential created for the
+// object with auth. It is issued its lifetime before its expiry, as requested
+// by applicationCredentialCreateOpts.
+func newCredentialVersion(object *ApplicationCredentialObject, auth map[string]string, expiresAt time.Time) credentialVersion {
+	v := credentialVersion{Fingerprint: object.Fingerprint(), Digest: versionDigest(object, auth)}
+	if !expiresAt.IsZero() {
+		v.ExpiresAt = expiresAt
+		v.IssuedAt = expiresAt.Add(-object.GetExpiresIn())
+	}
+	return v
+}
+
+// currentVersionsValid reports whether the credentials of the current object
+// versions were created for the objects with auths, their files rendered the
+// same way, and none expires within renewBefore of now. The driver keeps the
+// mounted files if Mount returns no files, so all of them are either kept or
+// renewed.
+func currentVersionsValid(current []*v1alpha1.ObjectVersion, objects []*ApplicationCredentialObject, auths []map[string]string, renewBefore time.Duration, now time.Time) bool {
+	if len(current) == 0 || len(current) != len(objects) {
+		return false
+	}
+	for i, objectVersion := range current {
+		v, ok := parseCredentialVersion(objectVersion.GetVersion())
+		if !ok || objectVersion.GetId() == "" || v.Fingerprint != objects[i].Fingerprint() || v.Digest != versionDigest(objects[i], auths[i]) {
+			return false
+		}
+		if !v.ExpiresAt.IsZero() && !now.Before(v.ExpiresAt.Add(-renewBefore)) {
+			return false
+		}
+	}
+	return true
+}
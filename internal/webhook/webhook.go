@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package webhook implements a validating admission webhook for
+// SecretProviderClasses of this provider, reusing the validation of Mount.
+package webhook
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/server"
+)
+
+// DefaultProviderName is SecretProviderClass.spec.provider handled by this
+// provider unless it is deployed with another --provider-name
+const DefaultProviderName = "openstack"
+
+// maxRequestSize limits AdmissionReview requests, the API server does not
+// send objects larger than etcd accepts
+const maxRequestSize = 3 << 20
+
+// AdmissionReview is the subset of admission.k8s.io/v1 AdmissionReview used
+// by the webhook
+type AdmissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *AdmissionRequest  `json:"request,omitempty"`
+	Response   *AdmissionResponse `json:"response,omitempty"`
+}
+
+type AdmissionRequest struct {
+	UID       string          `json:"uid"`
+	Operation string          `json:"operation"`
+	Object    json.RawMessage `json:"object,omitempty"`
+}
+
+type AdmissionResponse struct {
+	UID     string  `json:"uid"`
+	Allowed bool    `json:"allowed"`
+	Result  *Status `json:"status,omitempty"`
+}
+
+type Status struct {
+	Message string `json:"message,omitempty"`
+	Code    int32  `json:"code,omitempty"`
+}
+
+// SecretProviderClass is the subset of
+// secrets-store.csi.x-k8s.io/v1 SecretProviderClass validated by the webhook
+type SecretProviderClass struct {
+	Spec struct {
+		Provider   string            `json:"provider"`
+		Parameters map[string]string `json:"parameters"`
+	} `json:"spec"`
+}
+
+// Validate validates SecretProviderClass of providerName the way Mount does,
+// SecretProviderClasses of other providers are always valid
+func Validate(spc SecretProviderClass, providerName string) error {
+	if spc.Spec.Provider != providerName {
+		return nil
+	}
+	_, err := server.ParseApplicationCredentials(spc.Spec.Parameters)
+	return err
+}
+
+// Handler serves AdmissionReviews of SecretProviderClasses
+type Handler struct {
+	// ProviderName is spec.provider of the validated SecretProviderClasses,
+	// DefaultProviderName if empty
+	ProviderName string
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request, error: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxRequestSize {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var review AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "request should be an AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(AdmissionReview{
+		APIVersion: review.APIVersion,
+		Kind:       review.Kind,
+		Response:   review.Request.review(cmp.Or(h.ProviderName, DefaultProviderName)),
+	})
+}
+
+func (r *AdmissionRequest) review(providerName string) *AdmissionResponse {
+	response := &AdmissionResponse{UID: r.UID, Allowed: true}
+	// there is no object to validate on DELETE
+	if len(r.Object) == 0 {
+		return response
+	}
+
+	var spc SecretProviderClass
+	err := json.Unmarshal(r.Object, &spc)
+	if err == nil {
+		err = Validate(spc, providerName)
+	}
+	if err != nil {
+		slog.Info("Denied SecretProviderClass", "uid", r.UID, "error", err)
+		response.Allowed = false
+		response.Result = &Status{Message: err.Error(), Code: http.StatusUnprocessableEntity}
+	}
+	return response
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tests := map[string]struct {
+		providerName string
+		object       string
+		wantAllowed  bool
+		wantMessage  string
+	}{
+		"valid": {
+			object: `{"spec": {"provider": "openstack", "parameters": {
+				"applicationCredentials": "- fileName: clouds.yaml\n  format: openrc\n"
+			}}}`,
+			wantAllowed: true,
+		},
+		"other provider": {
+			object:      `{"spec": {"provider": "vault", "parameters": {"roleName": "app"}}}`,
+			wantAllowed: true,
+		},
+		"delete": {
+			wantAllowed: true,
+		},
+		"custom provider name": {
+			providerName: "openstack-staging",
+			object:       `{"spec": {"provider": "openstack-staging", "parameters": {}}}`,
+			wantMessage:  "applicationCredentials should be provided",
+		},
+		"default provider name with custom provider name": {
+			providerName: "openstack-staging",
+			object:       `{"spec": {"provider": "openstack", "parameters": {}}}`,
+			wantAllowed:  true,
+		},
+		"missing applicationCredentials": {
+			object:      `{"spec": {"provider": "openstack", "parameters": {}}}`,
+			wantMessage: "applicationCredentials should be provided",
+		},
+		"bad YAML": {
+			object: `{"spec": {"provider": "openstack", "parameters": {
+				"applicationCredentials": "- fileName: [clouds.yaml"
+			}}}`,
+			wantMessage: "failed to unmarshal applicationCredentials",
+		},
+		"unknown field": {
+			object: `{"spec": {"provider": "openstack", "parameters": {
+				"applicationCredentials": "- fileName: clouds.yaml\n  role: member\n"
+			}}}`,
+			wantMessage: `unknown field "role"`,
+		},
+		"unsafe path": {
+			object: `{"spec": {"provider": "openstack", "parameters": {
+				"applicationCredentials": "- fileName: ../clouds.yaml\n"
+			}}}`,
+			wantMessage: `fileName "../clouds.yaml" should be a relative path within the volume`,
+		},
+		"invalid template": {
+			object: `{"spec": {"provider": "openstack", "parameters": {
+				"applicationCredentials": "- fileName: clouds.yaml\n  template: '{{ env \"HOME\" }}'\n"
+			}}}`,
+			wantMessage: `function "env" not defined`,
+		},
+		"template depending on the credential": {
+			object: `{"spec": {"provider": "openstack", "parameters": {
+				"applicationCredentials": "- fileName: role\n  template: '{{ (index .Roles 1).Name }}'\n"
+			}}}`,
+			wantAllowed: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			review := AdmissionReview{
+				APIVersion: "admission.k8s.io/v1",
+				Kind:       "AdmissionReview",
+				Request:    &AdmissionRequest{UID: "uid", Operation: "CREATE"},
+			}
+			if tc.object != "" {
+				review.Request.Object = json.RawMessage(tc.object)
+			}
+			body, _ := json.Marshal(review)
+
+			rec := httptest.NewRecorder()
+			Handler{ProviderName: tc.providerName}.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(string(body))))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+			}
+
+			var got AdmissionReview
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.APIVersion != review.APIVersion || got.Kind != review.Kind {
+				t.Errorf("expected %s %s, got %s %s", review.APIVersion, review.Kind, got.APIVersion, got.Kind)
+			}
+			if got.Response == nil || got.Response.UID != "uid" {
+				t.Fatalf("expected response for uid, got %+v", got.Response)
+			}
+			if got.Response.Allowed != tc.wantAllowed {
+				t.Errorf("expected allowed %v, got %+v", tc.wantAllowed, got.Response)
+			}
+			if tc.wantMessage != "" && (got.Response.Result == nil || !strings.Contains(got.Response.Result.Message, tc.wantMessage)) {
+				t.Errorf("expected message containing %q, got %+v", tc.wantMessage, got.Response.Result)
+			}
+		})
+	}
+}
+
+func TestHandlerInvalidRequests(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		body       string
+		wantStatus int
+	}{
+		"GET": {
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		"not JSON": {
+			method:     http.MethodPost,
+			body:       "nope",
+			wantStatus: http.StatusBadRequest,
+		},
+		"no request": {
+			method:     http.MethodPost,
+			body:       `{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		"too large": {
+			method:     http.MethodPost,
+			body:       strings.Repeat(" ", maxRequestSize+1),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Handler{}.ServeHTTP(rec, httptest.NewRequest(tc.method, "/validate", strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+		})
+	}
+}
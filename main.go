@@ -5,57 +5,74 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"fmt"
 	"log"
 	"log/slog"
-	"net"
 	"os"
 	"os/signal"
 	"syscall"
-
-	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/provider"
-	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/server"
-	"google.golang.org/grpc"
-
-	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
-)
-
-var (
-	// might be reasonable to migrate /var/run/secrets-store-csi-provider path,
-	// https://github.com/kubernetes-sigs/secrets-store-csi-driver/issues/823
-	volumePath = flag.String("volume-path", "/etc/kubernetes/secrets-store-csi-providers", "path to directory where to serve the provider socket")
 )
 
 func main() {
-	flag.Parse()
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		if err := runRender(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	config, err := loadConfig(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	endpoint := fmt.Sprintf("%s/openstack.sock", *volumePath)
-	_ = os.Remove(endpoint)
-	grpcSrv := grpc.NewServer()
+	// registered before Run, so an early SIGHUP does not terminate the process
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
 
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, os.Interrupt)
-	go func() {
-		sig := <-sigs
-		slog.Info("Received signal to terminate", "signal", sig)
-		grpcSrv.GracefulStop()
-	}()
+	ctx, stop := notifyContext(context.Background())
+	defer stop()
 
-	listener, err := net.Listen("unix", endpoint)
-	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+	reload := make(chan Config)
+	go reloadOnHangup(ctx, hangup, reload, func() (Config, error) {
+		return loadConfig(os.Args[1:], os.LookupEnv)
+	})
+
+	if err := Run(ctx, config, reload); err != nil {
+		log.Fatal(err)
 	}
-	defer func() {
-		listener.Close()
-		os.Remove(endpoint)
-	}()
-	slog.Info("Listening for connections", "address", listener.Addr())
+}
+
+// notifyContext returns ctx done on signals sent to terminate the provider
+func notifyContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT, os.Interrupt)
+}
 
-	providerServer := server.NewServer(provider.Client{})
-	v1alpha1.RegisterCSIDriverProviderServer(grpcSrv, providerServer)
+// reloadOnHangup sends the configuration loaded anew to reload on every
+// signal received from hangup, until ctx is done. Configurations failing to
+// load are logged and not sent.
+func reloadOnHangup(ctx context.Context, hangup <-chan os.Signal, reload chan<- Config, load func() (Config, error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
 
-	if err := grpcSrv.Serve(listener); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
+		config, err := load()
+		if err != nil {
+			slog.Error("Failed to load configuration, keeping the previous one", "error", err)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case reload <- config:
+		}
 	}
 }
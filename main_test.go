@@ -0,0 +1,371 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/openstacktest"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func testConfig(t *testing.T) Config {
+	return Config{
+		VolumePath:           t.TempDir(),
+		ProviderName:         DefaultProviderName,
+		SocketUID:            -1,
+		SocketGID:            -1,
+		NameTemplate:         server.DefaultNameTemplate,
+		PolicyReloadInterval: time.Second,
+		ClientCacheTTL:       time.Minute,
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv := openstacktest.NewServer(t)
+	config := testConfig(t)
+	socket := filepath.Join(config.VolumePath, "openstack.sock")
+	// left behind by a previous instance
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := notifyContext(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- Run(ctx, config, nil) }()
+
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := v1alpha1.NewCSIDriverProviderClient(conn)
+
+	// the socket is created asynchronously
+	dialCtx, dialCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer dialCancel()
+	version, err := client.Version(dialCtx, &v1alpha1.VersionRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		t.Fatalf("Version failed: %v", err)
+	}
+	if version.GetRuntimeName() != "secrets-store-csi-driver-provider-openstack" {
+		t.Errorf("unexpected version %+v", version)
+	}
+
+	attributes, _ := json.Marshal(map[string]string{"applicationCredentials": "- fileName: clouds.yaml\n"})
+	secrets, _ := json.Marshal(srv.Credentials())
+	response, err := client.Mount(ctx, &v1alpha1.MountRequest{
+		Attributes: string(attributes),
+		Secrets:    string(secrets),
+		TargetPath: "/openstack-auth",
+		Permission: "420",
+	})
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	if len(response.GetFiles()) != 1 || len(srv.ApplicationCredentials()) != 1 {
+		t.Errorf("expected one file and credential, got %+v", response)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+	if _, err := os.Stat(socket); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket should be removed, got %v", err)
+	}
+}
+
+func TestRunSocketOptions(t *testing.T) {
+	config := testConfig(t)
+	config.ProviderName = "openstack-staging"
+	config.SocketMode = 0o660
+	config.SocketUID = os.Getuid()
+	config.SocketGID = os.Getgid()
+	config.MaxRecvMsgSize = 1 << 10
+	config.KeepaliveTime = time.Minute
+	socket := filepath.Join(config.VolumePath, "openstack-staging.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- Run(ctx, config, nil) }()
+
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := v1alpha1.NewCSIDriverProviderClient(conn)
+
+	dialCtx, dialCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer dialCancel()
+	if _, err := client.Version(dialCtx, &v1alpha1.VersionRequest{}, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("Version failed: %v", err)
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o660 {
+		t.Errorf("expected socket mode 0660, got %#o", info.Mode().Perm())
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if int(stat.Uid) != config.SocketUID || int(stat.Gid) != config.SocketGID {
+		t.Errorf("expected socket owner %d:%d, got %d:%d", config.SocketUID, config.SocketGID, stat.Uid, stat.Gid)
+	}
+	entries, err := os.ReadDir(config.VolumePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "openstack-staging.sock" {
+		t.Errorf("expected only the socket in the volume path, got %v", entries)
+	}
+
+	// larger than MaxRecvMsgSize
+	_, err = client.Mount(ctx, &v1alpha1.MountRequest{Attributes: strings.Repeat("x", 2<<10)})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
+
+func TestRunReload(t *testing.T) {
+	srv := openstacktest.NewServer(t)
+	config := testConfig(t)
+	config.NameTemplate = "first-{{ .Suffix }}"
+	socket := filepath.Join(config.VolumePath, "openstack.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reload := make(chan Config)
+	done := make(chan error)
+	go func() { done <- Run(ctx, config, reload) }()
+
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := v1alpha1.NewCSIDriverProviderClient(conn)
+
+	attributes, _ := json.Marshal(map[string]string{"applicationCredentials": "- fileName: clouds.yaml\n"})
+	secrets, _ := json.Marshal(srv.Credentials())
+	mount := func(wantPrefix string) {
+		t.Helper()
+		mountCtx, mountCancel := context.WithTimeout(ctx, 10*time.Second)
+		defer mountCancel()
+		response, err := client.Mount(mountCtx, &v1alpha1.MountRequest{
+			Attributes: string(attributes),
+			Secrets:    string(secrets),
+			TargetPath: "/openstack-auth",
+			Permission: "420",
+		}, grpc.WaitForReady(true))
+		if err != nil {
+			t.Fatalf("Mount failed: %v", err)
+		}
+		credentials := srv.ApplicationCredentials()
+		i := slices.IndexFunc(credentials, func(c openstacktest.ApplicationCredential) bool {
+			return c.ID == response.GetObjectVersion()[0].GetId()
+		})
+		if i < 0 || !strings.HasPrefix(credentials[i].Name, wantPrefix) {
+			t.Errorf("expected credential name with prefix %q, got %+v", wantPrefix, credentials)
+		}
+	}
+	mount("first-")
+
+	invalid := config
+	invalid.NameTemplate = "{{ .Nope }}"
+	reload <- invalid
+	mount("first-")
+
+	next := config
+	next.NameTemplate = "second-{{ .Suffix }}"
+	next.VolumePath = t.TempDir()
+	reload <- next
+	// received only once the previous configuration is applied
+	reload <- next
+	mount("second-")
+	if _, err := os.Stat(socket); err != nil {
+		t.Errorf("volume path should require a restart, got %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
+
+func TestReloadOnHangup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hangup := make(chan os.Signal, 1)
+	reload := make(chan Config)
+	loads := 0
+	done := make(chan struct{})
+	go func() {
+		reloadOnHangup(ctx, hangup, reload, func() (Config, error) {
+			loads++
+			if loads == 1 {
+				return Config{}, errors.New("invalid")
+			}
+			return Config{ProviderName: "reloaded"}, nil
+		})
+		close(done)
+	}()
+
+	hangup <- syscall.SIGHUP
+	hangup <- syscall.SIGHUP
+	select {
+	case config := <-reload:
+		if config.ProviderName != "reloaded" || loads != 2 {
+			t.Errorf("expected the second configuration, got %+v after %d loads", config, loads)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("configuration was not reloaded")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("reloadOnHangup did not stop")
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	running := Config{VolumePath: "/a", ProviderName: "openstack", NameTemplate: "a"}
+	next := Config{VolumePath: "/b", ProviderName: "openstack", NameTemplate: "b", SocketMode: 0o600}
+	if diff := cmp.Diff([]string{"socket-mode", "volume-path"}, restartRequired(running, next)); diff != "" {
+		t.Errorf("settings mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	tests := map[string]struct {
+		config  func(*Config)
+		wantErr string
+	}{
+		"invalid name template": {
+			config:  func(c *Config) { c.NameTemplate = "{{ .Nope }}" },
+			wantErr: "invalid name template",
+		},
+		"missing policy file": {
+			config:  func(c *Config) { c.PolicyFile = filepath.Join(c.VolumePath, "policy.yaml") },
+			wantErr: "failed to load policy",
+		},
+		"default credentials without policy": {
+			config:  func(c *Config) { c.DefaultCredentialsFromEnv = true },
+			wantErr: "default credentials require --policy-file",
+		},
+		"both default credentials": {
+			config: func(c *Config) {
+				c.DefaultCredentialsFile = "clouds.yaml"
+				c.DefaultCredentialsFromEnv = true
+			},
+			wantErr: "mutually exclusive",
+		},
+		"invalid provider name": {
+			config:  func(c *Config) { c.ProviderName = "../openstack" },
+			wantErr: `invalid provider name "../openstack"`,
+		},
+		"empty provider name": {
+			config:  func(c *Config) { c.ProviderName = "" },
+			wantErr: `invalid provider name ""`,
+		},
+		"invalid socket mode": {
+			config:  func(c *Config) { c.SocketMode = 0o4755 },
+			wantErr: "invalid socket mode 04755",
+		},
+		"invalid socket owner": {
+			config:  func(c *Config) { c.SocketUID = -2 },
+			wantErr: "invalid socket owner -2:-1",
+		},
+		"negative message size": {
+			config:  func(c *Config) { c.MaxSendMsgSize = -1 },
+			wantErr: "max message sizes should not be negative",
+		},
+		"negative keepalive": {
+			config:  func(c *Config) { c.KeepaliveTimeout = -time.Second },
+			wantErr: "keepalive durations should not be negative",
+		},
+		"negative default expiry": {
+			config:  func(c *Config) { c.DefaultExpiresIn = -time.Hour },
+			wantErr: "default expiresIn should not be negative",
+		},
+		"negative call timeout": {
+			config:  func(c *Config) { c.CallTimeout = -time.Second },
+			wantErr: "call timeout should not be negative",
+		},
+		"negative mount timeout": {
+			config:  func(c *Config) { c.MountTimeout = -time.Second },
+			wantErr: "mount timeout should not be negative",
+		},
+		"negative template timeout": {
+			config:  func(c *Config) { c.TemplateTimeout = -time.Second },
+			wantErr: "template timeout should not be negative",
+		},
+		"negative renew before": {
+			config:  func(c *Config) { c.RenewBefore = -time.Minute },
+			wantErr: "renew before should not be negative",
+		},
+		"invalid log format": {
+			config:  func(c *Config) { c.LogFormat = "xml" },
+			wantErr: `invalid log format "xml"`,
+		},
+		"missing volume path": {
+			config:  func(c *Config) { c.VolumePath = filepath.Join(c.VolumePath, "missing") },
+			wantErr: "failed to listen",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := testConfig(t)
+			tc.config(&config)
+			err := Run(context.Background(), config, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/policy"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/provider"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/render"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/server"
+)
+
+// dryRunSecrets stand for the nodePublishSecretRef Secret in dry runs without
+// --secrets
+var dryRunSecrets = map[string]string{"OS_AUTH_URL": "http://localhost:5000/v3/"}
+
+// runRender implements the render subcommand, printing the files a
+// SecretProviderClass would produce
+func runRender(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	spcFile := fs.String("secret-provider-class", "", "path to SecretProviderClass manifest")
+	secretsFile := fs.String("secrets", "", "path to the nodePublishSecretRef Secret manifest, or a YAML map of OS_* variables, required without --dry-run")
+	dryRun := fs.Bool("dry-run", true, "do not contact OpenStack, render placeholder credentials")
+	namespace := fs.String("namespace", "", "namespace of the Pod, defaults to the namespace of the SecretProviderClass")
+	podName := fs.String("pod-name", "pod", "name of the Pod")
+	podUID := fs.String("pod-uid", "00000000-0000-0000-0000-000000000000", "UID of the Pod")
+	serviceAccount := fs.String("service-account", "default", "service account of the Pod")
+	nameTemplate := fs.String("name-template", server.DefaultNameTemplate, "Go template generating application credential names")
+	policyFile := fs.String("policy-file", "", "path to policy file to check the request against")
+	providerName := fs.String("provider-name", DefaultProviderName, "spec.provider of the SecretProviderClass, the --provider-name of the provider")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s render --secret-provider-class FILE [--secrets FILE] [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *spcFile == "" {
+		fs.Usage()
+		return fmt.Errorf("--secret-provider-class is required")
+	}
+	if *secretsFile == "" && !*dryRun {
+		fs.Usage()
+		return fmt.Errorf("--secrets is required without --dry-run")
+	}
+
+	data, err := os.ReadFile(*spcFile)
+	if err != nil {
+		return err
+	}
+	spc, err := render.ParseSecretProviderClass(data, *providerName)
+	if err != nil {
+		return err
+	}
+
+	secrets := dryRunSecrets
+	if *secretsFile != "" {
+		data, err := os.ReadFile(*secretsFile)
+		if err != nil {
+			return err
+		}
+		if secrets, err = render.ParseSecret(data); err != nil {
+			return err
+		}
+	}
+
+	parsedNameTemplate, err := server.NewNameTemplate(*nameTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid name template, error: %w", err)
+	}
+	opts := []server.Option{server.WithNameTemplate(parsedNameTemplate)}
+	if *policyFile != "" {
+		p, err := policy.Load(*policyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, server.WithPolicy(policy.NewStore(p)))
+	}
+
+	var providerClient provider.ProviderClient = provider.DryRunClient{}
+	if !*dryRun {
+		providerClient = provider.NewClient(0)
+	}
+
+	const permission = 0o644
+	req, err := render.MountRequest(spc, secrets, render.Pod{
+		Namespace:      *namespace,
+		Name:           *podName,
+		UID:            *podUID,
+		ServiceAccount: *serviceAccount,
+	}, "/dev/null", permission)
+	if err != nil {
+		return err
+	}
+	response, err := server.NewServer(providerClient, opts...).Mount(ctx, req)
+	if err != nil {
+		return err
+	}
+	return render.Print(stdout, response, permission)
+}
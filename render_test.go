@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSecretProviderClass = `
+apiVersion: secrets-store.csi.x-k8s.io/v1
+kind: SecretProviderClass
+metadata:
+  name: my-openstack
+  namespace: team-a
+spec:
+  provider: openstack
+  parameters:
+    applicationCredentials: |
+      - fileName: clouds.yaml
+`
+
+func TestRunRender(t *testing.T) {
+	spcFile := filepath.Join(t.TempDir(), "spc.yaml")
+	if err := os.WriteFile(spcFile, []byte(testSecretProviderClass), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		args       []string
+		wantOutput string
+		wantErr    string
+	}{
+		"dry run without secrets": {
+			args:       []string{"--secret-provider-class", spcFile},
+			wantOutput: `auth_url: "http://localhost:5000/v3/"`,
+		},
+		"secrets required without dry run": {
+			args:    []string{"--secret-provider-class", spcFile, "--dry-run=false"},
+			wantErr: "--secrets is required without --dry-run",
+		},
+		"other provider name": {
+			args:    []string{"--secret-provider-class", spcFile, "--provider-name", "openstack-staging"},
+			wantErr: `spec.provider should be openstack-staging, got "openstack"`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runRender(context.TODO(), tc.args, &out)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runRender failed: %v", err)
+			}
+			if !strings.Contains(out.String(), tc.wantOutput) {
+				t.Errorf("output should contain %q, got:\n%s", tc.wantOutput, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+// SPDX-FileCopyrightText: 2025 Stanislav Zaprudskiy <stanislav.zaprudskiy@gmail.com>
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/policy"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/provider"
+	"github.com/stanislav-zaprudskiy/secrets-store-csi-driver-provider-openstack/internal/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+// DefaultProviderName is the provider name SecretProviderClasses refer to
+const DefaultProviderName = "openstack"
+
+// providerNameRegexp restricts provider names to safe socket file names
+var providerNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Config configures the provider server, see the flags for details
+type Config struct {
+	VolumePath string
+	// ProviderName names the socket, <ProviderName>.sock, which the driver
+	// matches against the provider of SecretProviderClasses
+	ProviderName string
+	// SocketMode is applied to the socket if not 0
+	SocketMode os.FileMode
+	// SocketUID and SocketGID own the socket, -1 leaves them unchanged
+	SocketUID int
+	SocketGID int
+	// MaxRecvMsgSize and MaxSendMsgSize bound gRPC messages, 0 uses the gRPC
+	// defaults
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+	// KeepaliveTime and KeepaliveTimeout configure server pings of idle
+	// connections, 0 uses the gRPC defaults
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+
+	NameTemplate         string
+	PolicyFile           string
+	PolicyReloadInterval time.Duration
+	ClientCacheTTL       time.Duration
+	// CallTimeout bounds every single OpenStack call and MountTimeout every
+	// Mount, in addition to the deadline of the driver, 0 disables them
+	CallTimeout  time.Duration
+	MountTimeout time.Duration
+	// TemplateTimeout bounds the execution of the templates of a Mount, 0
+	// disables it
+	TemplateTimeout time.Duration
+	// DefaultExpiresIn is the lifetime of credentials not setting expiresIn,
+	// server.DefaultExpiresIn if 0
+	DefaultExpiresIn time.Duration
+	// RenewBefore is how long before expiry credentials are renewed on
+	// rotation polls, 0 renews them on every poll
+	RenewBefore time.Duration
+
+	// LogLevel and LogFormat configure the default logger, kept as is if
+	// LogFormat is empty
+	LogLevel  slog.Level
+	LogFormat string
+
+	DefaultCredentialsFile    string
+	DefaultCloud              string
+	DefaultCredentialsFromEnv bool
+}
+
+// Run serves the provider on a unix socket in config.VolumePath until ctx is
+// done, then stops gracefully and removes the socket. Every configuration
+// received from reload replaces the running one, except for the settings
+// listed by restartRequired.
+func Run(ctx context.Context, config Config, reload <-chan Config) error {
+	grpcOptions, err := listenOptions(config)
+	if err != nil {
+		return err
+	}
+	if err := setupLogging(config); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// shared across reloads, so the client cache survives them
+	providerClient := provider.NewClient(config.ClientCacheTTL, provider.WithCallTimeout(config.CallTimeout))
+	serverCtx, serverCancel := context.WithCancel(ctx)
+	defer serverCancel()
+	providerServer, err := newProviderServer(serverCtx, config, providerClient)
+	if err != nil {
+		return err
+	}
+
+	endpoint := filepath.Join(config.VolumePath, config.ProviderName+".sock")
+	listener, err := listenUnix(endpoint, config.SocketMode, config.SocketUID, config.SocketGID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		listener.Close()
+		os.Remove(endpoint)
+	}()
+	slog.Info("Listening for connections", "address", endpoint)
+
+	grpcSrv := grpc.NewServer(grpcOptions...)
+	current := &reloadableServer{}
+	current.server.Store(providerServer)
+	v1alpha1.RegisterCSIDriverProviderServer(grpcSrv, current)
+
+	go func() {
+		// cancels the policy watch of the current server
+		cancelCurrent := serverCancel
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("Shutting down gracefully")
+				grpcSrv.GracefulStop()
+				return
+			case next := <-reload:
+				if settings := restartRequired(config, next); len(settings) > 0 {
+					slog.Warn("Changed settings require a restart and are ignored", "settings", settings)
+				}
+				nextCtx, nextCancel := context.WithCancel(ctx)
+				providerServer, err := newProviderServer(nextCtx, next, providerClient)
+				if err != nil {
+					nextCancel()
+					slog.Error("Invalid configuration, keeping the previous one", "error", err)
+					continue
+				}
+				cancelCurrent()
+				cancelCurrent = nextCancel
+				current.server.Store(providerServer)
+				logLevel.Set(next.LogLevel)
+				slog.Info("Reloaded configuration")
+			}
+		}
+	}()
+
+	// Serve reports ErrServerStopped if ctx is done before it starts
+	if err := grpcSrv.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("failed to serve, error: %w", err)
+	}
+	return nil
+}
+
+// listenUnix listens on a unix socket at endpoint with the mode and owner,
+// unless 0 and -1. The socket is created in a private directory and renamed
+// to endpoint once they are applied, so that no client can connect while it
+// still has the defaults of the umask. Renaming replaces a socket left behind
+// by a previous instance.
+func listenUnix(endpoint string, mode os.FileMode, uid, gid int) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(endpoint), ".sock-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen, error: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "socket")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen, error: %w", err)
+	}
+	// the socket is unlinked by renaming it, not by closing the listener
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := func() error {
+		if mode != 0 {
+			if err := os.Chmod(socket, mode); err != nil {
+				return fmt.Errorf("failed to set socket mode, error: %w", err)
+			}
+		}
+		if uid != -1 || gid != -1 {
+			if err := os.Chown(socket, uid, gid); err != nil {
+				return fmt.Errorf("failed to set socket owner, error: %w", err)
+			}
+		}
+		if err := os.Rename(socket, endpoint); err != nil {
+			return fmt.Errorf("failed to move socket into place, error: %w", err)
+		}
+		return nil
+	}(); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// newProviderServer validates the reloadable settings of config and returns
+// a server for them, watching the policy file until ctx is done
+func newProviderServer(ctx context.Context, config Config, providerClient provider.ProviderClient) (*server.CSIDriverProviderServer, error) {
+	parsedNameTemplate, err := server.NewNameTemplate(config.NameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template, error: %w", err)
+	}
+	if config.DefaultExpiresIn < 0 {
+		return nil, errors.New("default expiresIn should not be negative")
+	}
+	if config.MountTimeout < 0 {
+		return nil, errors.New("mount timeout should not be negative")
+	}
+	if config.TemplateTimeout < 0 {
+		return nil, errors.New("template timeout should not be negative")
+	}
+	if config.RenewBefore < 0 {
+		return nil, errors.New("renew before should not be negative")
+	}
+
+	var policyStore *policy.Store
+	if config.PolicyFile != "" {
+		p, err := policy.Load(config.PolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load policy, error: %w", err)
+		}
+		policyStore = policy.NewStore(p)
+		go policyStore.Watch(ctx, config.PolicyFile, config.PolicyReloadInterval)
+	}
+
+	var defaultCredentials provider.CredentialsSource
+	switch {
+	case config.DefaultCredentialsFile != "" && config.DefaultCredentialsFromEnv:
+		return nil, errors.New("--default-credentials-file and --default-credentials-from-env are mutually exclusive")
+	case config.DefaultCredentialsFile != "":
+		defaultCredentials = provider.CloudsFile{Path: config.DefaultCredentialsFile, Cloud: config.DefaultCloud}
+	case config.DefaultCredentialsFromEnv:
+		defaultCredentials = provider.Environment{}
+	}
+	if defaultCredentials != nil {
+		if policyStore == nil {
+			return nil, errors.New("default credentials require --policy-file")
+		}
+		if _, err := defaultCredentials.Credentials(); err != nil {
+			return nil, fmt.Errorf("failed to load default credentials, error: %w", err)
+		}
+	}
+
+	return server.NewServer(
+		providerClient,
+		server.WithNameTemplate(parsedNameTemplate),
+		server.WithPolicy(policyStore),
+		server.WithDefaultCredentials(defaultCredentials),
+		server.WithDefaultExpiresIn(config.DefaultExpiresIn),
+		server.WithMountTimeout(config.MountTimeout),
+		server.WithTemplateTimeout(config.TemplateTimeout),
+		server.WithRenewBefore(config.RenewBefore),
+	), nil
+}
+
+// reloadableServer serves with the current provider server, replaced on
+// reload
+type reloadableServer struct {
+	v1alpha1.UnimplementedCSIDriverProviderServer
+	server atomic.Pointer[server.CSIDriverProviderServer]
+}
+
+func (s *reloadableServer) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error) {
+	return s.server.Load().Mount(ctx, req)
+}
+
+func (s *reloadableServer) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1alpha1.VersionResponse, error) {
+	return s.server.Load().Version(ctx, req)
+}
+
+// restartRequired returns the flags of settings changed from running to
+// next, which only apply on start
+func restartRequired(running, next Config) []string {
+	changed := map[string]bool{
+		"volume-path":       running.VolumePath != next.VolumePath,
+		"provider-name":     running.ProviderName != next.ProviderName,
+		"socket-mode":       running.SocketMode != next.SocketMode,
+		"socket-uid":        running.SocketUID != next.SocketUID,
+		"socket-gid":        running.SocketGID != next.SocketGID,
+		"max-recv-msg-size": running.MaxRecvMsgSize != next.MaxRecvMsgSize,
+		"max-send-msg-size": running.MaxSendMsgSize != next.MaxSendMsgSize,
+		"keepalive-time":    running.KeepaliveTime != next.KeepaliveTime,
+		"keepalive-timeout": running.KeepaliveTimeout != next.KeepaliveTimeout,
+		"log-format":        running.LogFormat != next.LogFormat,
+		"client-cache-ttl":  running.ClientCacheTTL != next.ClientCacheTTL,
+		"call-timeout":      running.CallTimeout != next.CallTimeout,
+	}
+	var settings []string
+	for name, changed := range changed {
+		if changed {
+			settings = append(settings, name)
+		}
+	}
+	slices.Sort(settings)
+	return settings
+}
+
+// logLevel is the level of the default logger set up by setupLogging, changed
+// on reload
+var logLevel slog.LevelVar
+
+// setupLogging replaces the default logger according to LogFormat, keeping
+// it if LogFormat is empty
+func setupLogging(config Config) error {
+	logLevel.Set(config.LogLevel)
+	options := &slog.HandlerOptions{Level: &logLevel}
+	switch config.LogFormat {
+	case "":
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, options)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, options)))
+	default:
+		return fmt.Errorf("invalid log format %q, should be text or json", config.LogFormat)
+	}
+	return nil
+}
+
+// listenOptions validates the socket and gRPC settings of config and returns
+// the gRPC server options for them
+func listenOptions(config Config) ([]grpc.ServerOption, error) {
+	if !providerNameRegexp.MatchString(config.ProviderName) {
+		return nil, fmt.Errorf("invalid provider name %q, should match %s", config.ProviderName, providerNameRegexp)
+	}
+	if config.SocketMode&^os.ModePerm != 0 {
+		return nil, fmt.Errorf("invalid socket mode %#o, should only contain permission bits", uint32(config.SocketMode))
+	}
+	if config.SocketUID < -1 || config.SocketGID < -1 {
+		return nil, fmt.Errorf("invalid socket owner %d:%d, should be -1 or greater", config.SocketUID, config.SocketGID)
+	}
+	if config.MaxRecvMsgSize < 0 || config.MaxSendMsgSize < 0 {
+		return nil, errors.New("max message sizes should not be negative")
+	}
+	if config.KeepaliveTime < 0 || config.KeepaliveTimeout < 0 {
+		return nil, errors.New("keepalive durations should not be negative")
+	}
+	if config.CallTimeout < 0 {
+		return nil, errors.New("call timeout should not be negative")
+	}
+
+	var options []grpc.ServerOption
+	if config.MaxRecvMsgSize > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(config.MaxRecvMsgSize))
+	}
+	if config.MaxSendMsgSize > 0 {
+		options = append(options, grpc.MaxSendMsgSize(config.MaxSendMsgSize))
+	}
+	if config.KeepaliveTime > 0 || config.KeepaliveTimeout > 0 {
+		options = append(options, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    config.KeepaliveTime,
+			Timeout: config.KeepaliveTimeout,
+		}))
+	}
+	return options, nil
+}